@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	benchmark "github.com/Harardin/rate-limit/internal/bench"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+// bench drives the limiter check api and prints latency percentiles, throughput and decision accuracy
+func bench(args []string) {
+	var cfg benchmark.Config
+
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.StringVar(&cfg.URL, "url", "http://localhost:20001", "limiter http api address")
+	fs.StringVar(&cfg.Route, "route", "/bench", "route of check requests")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 10, "number of concurrent workers")
+	fs.IntVar(&cfg.Keys, "keys", 1000, "number of distinct keys")
+	fs.StringVar(&cfg.Distribution, "distribution", benchmark.DistributionUniform, "key distribution: uniform or zipf")
+	fs.Float64Var(&cfg.ZipfS, "zipf-s", benchmark.DefaultZipfS, "skew of zipf distribution, must be > 1")
+	fs.Float64Var(&cfg.Rate, "rate", 0, "requests per second of all workers, 0 - as fast as possible")
+	fs.DurationVar(&cfg.Duration, "duration", 10*time.Second, "duration of the run")
+	fs.Int64Var(&cfg.Requests, "requests", 0, "stop after the number of requests, 0 - run for -duration")
+	fs.Int64Var(&cfg.Cost, "cost", 1, "cost of a request")
+	output := fs.String("output", "table", "output format: table or json")
+	fs.Parse(args)
+
+	if *output != "table" && *output != "json" {
+		exitUsage(fmt.Sprintf("unknown output format \"%s\"", *output))
+	}
+
+	// only -requests limits the run if it is set
+	if cfg.Requests > 0 {
+		cfg.Duration = 0
+	}
+
+	logger := log.New()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        cfg.Concurrency,
+			MaxIdleConnsPerHost: cfg.Concurrency,
+		},
+	}
+
+	report, err := benchmark.Run(ctx, cfg, client)
+	if err != nil {
+		logger.Fatalf("bench error: %v", err)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			logger.Fatalf("failed to write report: %v", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "requests\t%d\n", report.Requests)
+	fmt.Fprintf(w, "allowed\t%d (%d without rule)\n", report.Allowed, report.Unlimited)
+	fmt.Fprintf(w, "rejected\t%d\n", report.Rejected)
+	fmt.Fprintf(w, "banned or blocked\t%d\n", report.Blocked)
+	fmt.Fprintf(w, "errors\t%d\n", report.Errors)
+	fmt.Fprintf(w, "duration\t%s\n", report.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput\t%.1f req/s\n", report.Throughput)
+	fmt.Fprintf(w, "latency\tp50 %s, p90 %s, p99 %s, max %s\n",
+		report.Latency.P50, report.Latency.P90, report.Latency.P99, report.Latency.Max)
+	fmt.Fprintf(w, "accuracy\t%.4f over %d windows: %d over admitted, %d under admitted\n",
+		report.Accuracy.Ratio, report.Accuracy.Windows, report.Accuracy.OverAdmitted, report.Accuracy.UnderAdmitted)
+	w.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/Harardin/rate-limit/internal/config"
+	"github.com/Harardin/rate-limit/pkg/initialconfig"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+const redacted = "******"
+
+// checkConfig loads config from env, .env, consul and vault and validates it. Exits with error if config is invalid
+func checkConfig() {
+	logger := log.New()
+
+	var current atomic.Pointer[config.Config]
+	initialconfig.LoadConfig(logger, &current)
+
+	fmt.Println("config is valid")
+}
+
+// printConfig prints merged config with redacted secrets and the source of each value
+func printConfig() {
+	logger := log.New()
+
+	var current atomic.Pointer[config.Config]
+	sources := make(initialconfig.Sources)
+	initialconfig.LoadConfig(logger, &current, initialconfig.WithSources(sources))
+
+	envs := initialconfig.GetConfigParams(*current.Load())
+
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+
+	for _, name := range names {
+		params := envs[name]
+
+		value := fmt.Sprint(params.Value)
+		if params.IsSecret && !reflect.ValueOf(params.Value).IsZero() {
+			value = redacted
+		}
+
+		source := sources[name]
+		if source == "" {
+			source = initialconfig.SourceDefault
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, value, source)
+	}
+
+	w.Flush()
+}
@@ -1,76 +1,49 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
-
-	"github.com/Harardin/rate-limit/internal/config"
-	"github.com/Harardin/rate-limit/internal/server"
-	"github.com/Harardin/rate-limit/pkg/initialconfig"
-	"github.com/Harardin/rate-limit/pkg/log"
 )
 
-func main() {
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
-
-	// Init logger
-	logger := log.New()
-	defer logger.Sync()
-
-	// Loading service config
-	cfg := new(config.Config)
-	configChangedEnvsCh := initialconfig.LoadConfig(logger, cfg)
+const usage = `Usage: ratelimit <command> [arguments]
+
+Commands:
+  serve                   start the service (default)
+  check-config            load and validate config without starting the service
+  print-config            print config with redacted secrets and value sources
+  migrate up [N]          apply N or all pending migrations
+  migrate down [N]        revert N (default 1) last migrations
+  migrate status          print migrations status
+  simulate -rules F -trace F [-trace-format csv|jsonl] [-output table|json]
+                          replay a traffic trace against rules with a virtual clock
+  bench [flags]           load the check api and report latency, throughput and accuracy, see bench -h
+  version                 print build info
+`
 
-	// Init Server
-	srv, err := server.New(logger, cfg)
-	if err != nil {
-		logger.Fatalf("init server error: %v", err)
+func main() {
+	cmd, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		cmd, args = os.Args[1], os.Args[2:]
 	}
 
-	// Start server
-	wg := new(sync.WaitGroup)
-	wg.Add(1)
-	go startServer(logger, cfg, sig, wg, srv, configChangedEnvsCh)
-
-	// Wait system signals
-	<-sig
-	close(sig)
-
-	wg.Wait()
-}
-
-func startServer(logger log.Logger, cfg *config.Config, sig <-chan os.Signal, wg *sync.WaitGroup, srv *server.Server, configChangedEnvsCh chan []string) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Graceful shutdown
-	go func() {
-		<-sig
-		cancel()
-		wg.Done()
-	}()
-
-	for {
-		// Start server
-		go func(ctx context.Context) {
-			defer wg.Done()
-			wg.Add(1)
-
-			if err := srv.Start(ctx); err != nil {
-				logger.Fatalf("start server error: %v", err)
-			}
-		}(ctx)
-
-		// You can restart certain services based on environment names
-		changedEnvs := <-configChangedEnvsCh
-
-		logger.Infof("changed enviroments: %v", changedEnvs)
-
-		cancel()
-
-		ctx, cancel = context.WithCancel(context.Background())
+	switch cmd {
+	case "serve":
+		serve()
+	case "check-config":
+		checkConfig()
+	case "print-config":
+		printConfig()
+	case "migrate":
+		migrate(args)
+	case "simulate":
+		simulate(args)
+	case "bench":
+		bench(args)
+	case "version":
+		printVersion()
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		exitUsage(fmt.Sprintf("unknown command \"%s\"", cmd))
 	}
 }
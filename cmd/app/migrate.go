@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/config"
+	migrator "github.com/Harardin/rate-limit/internal/migrate"
+	"github.com/Harardin/rate-limit/pkg/initialconfig"
+	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+	"github.com/Harardin/rate-limit/sql/migrations"
+)
+
+// migrate applies or reverts postgres migrations: migrate up [N] | down [N] | status
+func migrate(args []string) {
+	if len(args) == 0 {
+		exitUsage("migrate command is required")
+	}
+
+	cmd := args[0]
+
+	// up applies all pending migrations by default, down reverts the last one
+	n := 0
+	if cmd == "down" {
+		n = 1
+	}
+
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 1 {
+			exitUsage(fmt.Sprintf("bad number of migrations \"%s\"", args[1]))
+		}
+		n = v
+	}
+
+	logger := log.New()
+
+	var current atomic.Pointer[config.Config]
+	initialconfig.LoadConfig(logger, &current)
+	cfg := current.Load()
+
+	ms, err := migrator.Load(migrations.FS)
+	if err != nil {
+		logger.Fatalf("failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+
+	db, err := postgres.NewPostgreSQL(ctx, logger, cfg.Postgres, cfg.GetPostgresAddr())
+	if err != nil {
+		logger.Fatalf("failed to connect to postgres: %v", err)
+	}
+	defer db.Close()
+
+	m := migrator.NewMigrator(logger, db, ms)
+
+	switch cmd {
+	case "up":
+		res, err := m.Up(ctx, n)
+		if err != nil {
+			logger.Fatalf("migrate up error: %v", err)
+		}
+		fmt.Printf("%d migrations applied\n", len(res))
+	case "down":
+		res, err := m.Down(ctx, n)
+		if err != nil {
+			logger.Fatalf("migrate down error: %v", err)
+		}
+		fmt.Printf("%d migrations reverted\n", len(res))
+	case "status":
+		res, err := m.Status(ctx)
+		if err != nil {
+			logger.Fatalf("migrate status error: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range res {
+			appliedAt := "pending"
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		exitUsage(fmt.Sprintf("unknown migrate command \"%s\"", cmd))
+	}
+}
+
+func exitUsage(msg string) {
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", msg, usage)
+	os.Exit(2)
+}
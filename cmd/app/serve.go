@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/config"
+	"github.com/Harardin/rate-limit/internal/server"
+	"github.com/Harardin/rate-limit/pkg/initialconfig"
+	"github.com/Harardin/rate-limit/pkg/lifecycle"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+// serve starts the service and applies config changes until a system signal
+func serve() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	// Init logger
+	logger := log.New()
+
+	// Loading service config. The config is replaced on changes, so it is shared by pointer
+	var cfg atomic.Pointer[config.Config]
+	reloadConfig := make(chan struct{}, 1)
+	configChangedEnvsCh := initialconfig.LoadConfig(logger, &cfg, initialconfig.WithReload(reloadConfig))
+
+	// Init Server. The config is re-read on the reload_rules control command
+	srv, err := server.New(logger, &cfg, server.WithReloadConfig(func() {
+		select {
+		case reloadConfig <- struct{}{}:
+		default:
+		}
+	}))
+	if err != nil {
+		logger.Fatalf("init server error: %v", err)
+	}
+
+	// Register components. The http server finishes active requests within the shutdown timeout
+	m := lifecycle.New(logger, lifecycle.WithStopTimeout(time.Duration(cfg.Load().HTTP.ShutdownTimeout+5)*time.Second))
+	if err := srv.Register(m); err != nil {
+		logger.Fatalf("register components error: %v", err)
+	}
+
+	// Start server
+	if err := m.Start(context.Background()); err != nil {
+		logger.Fatalf("start server error: %v", err)
+	}
+
+	exitCode := run(logger, m, srv, sig, configChangedEnvsCh)
+
+	// Graceful shutdown
+	if err := m.Stop(); err != nil {
+		logger.Errorf("stop server error: %v", err)
+	}
+
+	srv.Close()
+
+	logger.Sync()
+	os.Exit(exitCode)
+}
+
+// resumeInterval - time between attempts to start components which failed to restart
+const resumeInterval = 10 * time.Second
+
+// run applies config changes until a system signal or a component failure. Return exit code
+func run(logger log.Logger, m *lifecycle.Manager, srv *server.Server, sig <-chan os.Signal, configChangedEnvsCh chan []string) int {
+	// resume is not nil while some components are not running after a failed restart
+	var resume <-chan time.Time
+
+	for {
+		select {
+		case <-sig:
+			return 0
+		case err := <-m.Errors():
+			logger.Errorf("server error: %v", err)
+			return 1
+		case <-resume:
+			resume = nil
+
+			started, err := m.Resume(context.Background())
+			if err != nil {
+				logger.Errorf("resume components error: %v, retry in %s", err, resumeInterval)
+				resume = time.After(resumeInterval)
+			}
+
+			if len(started) > 0 {
+				logger.Infof("components resumed: %s", strings.Join(started, ", "))
+			}
+		case changedEnvs := <-configChangedEnvsCh:
+			logger.Infof("changed enviroments: %v", changedEnvs)
+
+			// You can restart certain services based on environment names
+			restartEnvs := hotReload(logger, srv, changedEnvs)
+			if len(restartEnvs) == 0 {
+				continue
+			}
+
+			restarted, err := m.Restart(context.Background(), restartEnvs)
+			if err != nil {
+				// components started before the failure keep serving, the rest are started again until they succeed
+				logger.Errorf("restart components error: %v, retry in %s", err, resumeInterval)
+				resume = time.After(resumeInterval)
+				continue
+			}
+
+			if len(restarted) == 0 {
+				logger.Warnf("no components are subscribed to %v, changes are applied on the next start", restartEnvs)
+			}
+		}
+	}
+}
+
+// hotReload applies changed envs without restart. Return envs which require restart of components
+func hotReload(logger log.Logger, srv *server.Server, changedEnvs []string) []string {
+	reloaders := map[string]func() error{
+		// limiter rules
+		"RATE_LIMIT_RULES": srv.ReloadRules,
+		// certificates rotated in vault
+		"TLS_CERT":      srv.ReloadTLS,
+		"TLS_KEY":       srv.ReloadTLS,
+		"TLS_CLIENT_CA": srv.ReloadTLS,
+		// client auth mode is selected on each handshake, the cert key is read on each request
+		"TLS_CLIENT_AUTH":     srv.ReloadTLS,
+		"TLS_CLIENT_CERT_KEY": srv.ReloadTLS,
+	}
+
+	var restartEnvs []string
+	reloaded := make(map[string]bool)
+	for _, env := range changedEnvs {
+		reload, ok := reloaders[env]
+		if !ok {
+			restartEnvs = append(restartEnvs, env)
+			continue
+		}
+
+		// cert and key are reloaded together
+		group := env
+		if strings.HasPrefix(env, "TLS_") {
+			group = "TLS"
+		}
+
+		if reloaded[group] {
+			continue
+		}
+		reloaded[group] = true
+
+		if err := reload(); err != nil {
+			logger.Errorf("failed to apply %s: %v", env, err)
+		}
+	}
+
+	return restartEnvs
+}
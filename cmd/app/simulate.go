@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	simulator "github.com/Harardin/rate-limit/internal/simulate"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+// simulate replays a traffic trace against rules with a virtual clock and prints decisions per key and rule
+func simulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	rulesFile := fs.String("rules", "", "rules file in RATE_LIMIT_RULES format")
+	traceFile := fs.String("trace", "", "traffic trace, csv or jsonl")
+	traceFormat := fs.String("trace-format", "", "trace format: csv or jsonl, by default by the file extension")
+	output := fs.String("output", "table", "output format: table or json")
+	fs.Parse(args)
+
+	if *rulesFile == "" || *traceFile == "" {
+		exitUsage("simulate requires -rules and -trace")
+	}
+
+	if *output != "table" && *output != "json" {
+		exitUsage(fmt.Sprintf("unknown output format \"%s\"", *output))
+	}
+
+	// shadow decisions are reported, so only warnings are logged
+	logger := log.New(log.WithLogLevel(log.WARNING))
+
+	data, err := os.ReadFile(*rulesFile)
+	if err != nil {
+		logger.Fatalf("failed to read rules: %v", err)
+	}
+
+	rules, err := limiter.ParseRules(string(data))
+	if err != nil {
+		logger.Fatalf("failed to parse rules: %v", err)
+	}
+
+	format := *traceFormat
+	if format == "" {
+		format = simulator.FormatJSONL
+		if strings.EqualFold(filepath.Ext(*traceFile), ".csv") {
+			format = simulator.FormatCSV
+		}
+	}
+
+	f, err := os.Open(*traceFile)
+	if err != nil {
+		logger.Fatalf("failed to open trace: %v", err)
+	}
+	defer f.Close()
+
+	records, err := simulator.ReadTrace(f, format)
+	if err != nil {
+		logger.Fatalf("failed to read trace: %v", err)
+	}
+
+	report, err := simulator.Run(context.Background(), logger, rules, records)
+	if err != nil {
+		logger.Fatalf("simulation error: %v", err)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			logger.Fatalf("failed to write report: %v", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tRULE\tALLOWED\tREJECTED\tSHADOW REJECTED")
+	for _, r := range report.Results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", r.Key, r.Rule, r.Allowed, r.Rejected, r.ShadowRejected)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d requests from %s to %s: %d allowed, %d rejected\n",
+		report.Requests, report.Start.Format(time.RFC3339), report.End.Format(time.RFC3339), report.Allowed, report.Rejected)
+}
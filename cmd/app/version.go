@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build info, set with ldflags:
+//
+//	-ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+func printVersion() {
+	rev, at := commit, buildTime
+
+	// fallback to vcs info stamped by go build
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+			case s.Key == "vcs.time" && at == "":
+				at = s.Value
+			}
+		}
+	}
+
+	fmt.Printf("version: %s\ncommit: %s\nbuild time: %s\ngo: %s %s/%s\n", version, rev, at, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
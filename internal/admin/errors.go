@@ -0,0 +1,5 @@
+package admin
+
+import "errors"
+
+var ErrValidation = errors.New("validation error")
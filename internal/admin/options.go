@@ -0,0 +1,12 @@
+package admin
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(s *Service)
+
+// WithClock - clock of syncs and reconnects of notifications. Default clock.Real
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
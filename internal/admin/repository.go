@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// overridesChannel is notified on every change of overrides, so all instances reload them
+const overridesChannel = "limit_overrides"
+
+type Repository struct {
+	db *postgres.PostgreSQL
+}
+
+func NewRepository(db *postgres.PostgreSQL) *Repository {
+	return &Repository{db: db}
+}
+
+// SaveOverride creates or replaces the override of the key and rule
+func (r *Repository) SaveOverride(ctx context.Context, o limiter.Override) (limiter.Override, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return o, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO limit_overrides (key, rule, action, "limit", reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key, rule) DO UPDATE SET
+			action = EXCLUDED.action,
+			"limit" = EXCLUDED."limit",
+			reason = EXCLUDED.reason,
+			expires_at = EXCLUDED.expires_at,
+			created_at = now()
+		RETURNING created_at`,
+		o.Key, o.Rule, o.Action, o.Limit, o.Reason, o.ExpiresAt,
+	).Scan(&o.CreatedAt)
+	if err != nil {
+		return o, fmt.Errorf("failed to save override: %v", err)
+	}
+
+	if err := notify(ctx, tx, o.Key); err != nil {
+		return o, err
+	}
+
+	return o, tx.Commit(ctx)
+}
+
+// DeleteOverride removes the override of the key and rule
+func (r *Repository) DeleteOverride(ctx context.Context, key, rule string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM limit_overrides WHERE key = $1 AND rule = $2`, key, rule); err != nil {
+		return fmt.Errorf("failed to delete override: %v", err)
+	}
+
+	if err := notify(ctx, tx, key); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ActiveOverrides return not expired overrides
+func (r *Repository) ActiveOverrides(ctx context.Context) ([]limiter.Override, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT key, rule, action, "limit", reason, expires_at, created_at
+		FROM limit_overrides
+		WHERE expires_at > now()
+		ORDER BY key, rule`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select overrides: %v", err)
+	}
+	defer rows.Close()
+
+	res := make([]limiter.Override, 0)
+	for rows.Next() {
+		var o limiter.Override
+		if err := rows.Scan(&o.Key, &o.Rule, &o.Action, &o.Limit, &o.Reason, &o.ExpiresAt, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, o)
+	}
+
+	return res, rows.Err()
+}
+
+// DeleteExpiredOverrides removes expired overrides
+func (r *Repository) DeleteExpiredOverrides(ctx context.Context) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM limit_overrides WHERE expires_at <= now()`)
+	return err
+}
+
+// ListenOverrides calls fn on every overrides change until ctx is done or connection is lost
+func (r *Repository) ListenOverrides(ctx context.Context, fn func()) error {
+	return r.db.Listen(ctx, overridesChannel, func(string) {
+		fn()
+	})
+}
+
+func notify(ctx context.Context, tx pgx.Tx, key string) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, overridesChannel, key); err != nil {
+		return fmt.Errorf("failed to notify about override change: %v", err)
+	}
+
+	return nil
+}
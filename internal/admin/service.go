@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	Enabled bool   `json:"ADMIN_ENABLED"`
+	Token   string `json:"ADMIN_TOKEN" secret:"true"`
+	// Full reload of overrides, in addition to change notifications. In seconds. Default 30 seconds
+	SyncInterval int `json:"ADMIN_SYNC_INTERVAL" default:"30"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Token, validation.Required, validation.Length(16, 0)),
+		validation.Field(&c.SyncInterval, validation.Required, validation.Min(1)),
+	)
+}
+
+// Service manages per key overrides. Overrides are persisted in postgres and
+// propagated to all instances with postgres notifications.
+type Service struct {
+	logger log.Logger
+	clock  clock.Clock
+	// repo is replaced on reconnect to postgres
+	repo    atomic.Pointer[Repository]
+	limiter *limiter.Limiter
+
+	syncInterval time.Duration
+}
+
+func NewService(logger log.Logger, db *postgres.PostgreSQL, l *limiter.Limiter, cfg Config, opts ...Option) *Service {
+	syncInterval := time.Duration(cfg.SyncInterval) * time.Second
+	if syncInterval == 0 {
+		syncInterval = 30 * time.Second
+	}
+
+	s := &Service{
+		logger:       logger,
+		clock:        clock.Real{},
+		limiter:      l,
+		syncInterval: syncInterval,
+	}
+	s.SetDB(db)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// SetDB replaces the postgres connection of the service, e.g. after reconnect
+func (s *Service) SetDB(db *postgres.PostgreSQL) {
+	s.repo.Store(NewRepository(db))
+}
+
+// Start loads overrides and keeps them in sync until ctx is done
+func (s *Service) Start(ctx context.Context) {
+	if err := s.Sync(ctx); err != nil {
+		s.logger.Errorf("failed to load overrides: %v", err)
+	}
+
+	go s.listen(ctx)
+
+	ticker := s.clock.NewTicker(s.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := s.repo.Load().DeleteExpiredOverrides(ctx); err != nil {
+				s.logger.Errorf("failed to delete expired overrides: %v", err)
+			}
+
+			if err := s.Sync(ctx); err != nil {
+				s.logger.Errorf("failed to sync overrides: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sync reloads all active overrides into the limiter
+func (s *Service) Sync(ctx context.Context) error {
+	overrides, err := s.repo.Load().ActiveOverrides(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.limiter.SetOverrides(overrides)
+
+	return nil
+}
+
+func (s *Service) listen(ctx context.Context) {
+	for {
+		err := s.repo.Load().ListenOverrides(ctx, func() {
+			if err := s.Sync(ctx); err != nil {
+				s.logger.Errorf("failed to sync overrides: %v", err)
+			}
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.logger.Errorf("overrides notifications are lost, reconnecting: %v", err)
+
+		select {
+		case <-s.clock.After(time.Second * 5):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SetOverride validates and saves the override, it is applied on all instances
+func (s *Service) SetOverride(ctx context.Context, o limiter.Override) (limiter.Override, error) {
+	if err := o.ValidateAt(s.limiter.Now()); err != nil {
+		return o, errors.Join(ErrValidation, err)
+	}
+
+	o, err := s.repo.Load().SaveOverride(ctx, o)
+	if err != nil {
+		return o, err
+	}
+
+	s.logger.Infof("override \"%s\" for key \"%s\" rule \"%s\" is set until %s", o.Action, o.Key, o.Rule, o.ExpiresAt)
+
+	return o, s.Sync(ctx)
+}
+
+func (s *Service) DeleteOverride(ctx context.Context, key, rule string) error {
+	if err := s.repo.Load().DeleteOverride(ctx, key, rule); err != nil {
+		return err
+	}
+
+	s.logger.Infof("override for key \"%s\" rule \"%s\" is deleted", key, rule)
+
+	return s.Sync(ctx)
+}
+
+func (s *Service) ListOverrides(ctx context.Context) ([]limiter.Override, error) {
+	return s.repo.Load().ActiveOverrides(ctx)
+}
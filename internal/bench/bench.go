@@ -0,0 +1,311 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"golang.org/x/time/rate"
+)
+
+// DefaultZipfS - skew of zipf distribution, the hottest key gets about a third of requests
+const DefaultZipfS = 1.1
+
+type Config struct {
+	// URL of the limiter http api
+	URL string
+	// Route - route of check requests
+	Route       string
+	Concurrency int
+	// Keys - cardinality of keys
+	Keys         int
+	Distribution string
+	// ZipfS - skew of zipf distribution, must be > 1
+	ZipfS float64
+	// Rate - requests per second of all workers, 0 - as fast as possible
+	Rate     float64
+	Duration time.Duration
+	// Requests - stop after the number of requests, 0 - run for Duration
+	Requests int64
+	Cost     int64
+}
+
+func (c *Config) Validate() error {
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.URL, validation.Required),
+		validation.Field(&c.Route, validation.Required),
+		validation.Field(&c.Concurrency, validation.Required, validation.Min(1)),
+		validation.Field(&c.Keys, validation.Required, validation.Min(1)),
+		validation.Field(&c.Distribution, validation.In(DistributionUniform, DistributionZipf)),
+		validation.Field(&c.ZipfS, validation.When(c.Distribution == DistributionZipf, validation.Min(1.0), validation.NotIn(1.0))),
+		validation.Field(&c.Rate, validation.Min(0.0)),
+		validation.Field(&c.Duration, validation.When(c.Requests == 0, validation.Required)),
+		validation.Field(&c.Requests, validation.Min(int64(0))),
+		validation.Field(&c.Cost, validation.Required, validation.Min(int64(1))),
+	)
+}
+
+// Latency percentiles
+type Latency struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Accuracy of decisions against the limit reported by the limiter.
+//
+// Decisions are grouped into windows by key, rule and reset time, so it is exact for fixed and calendar windows.
+// In every window the limiter is expected to allow min(sent, limit) cost units.
+type Accuracy struct {
+	Windows int64 `json:"windows"`
+	// OverAdmitted - cost units allowed over the limit
+	OverAdmitted int64 `json:"over_admitted"`
+	// UnderAdmitted - cost units rejected while the window had quota
+	UnderAdmitted int64 `json:"under_admitted"`
+	// Ratio - share of correctly decided cost units
+	Ratio float64 `json:"ratio"`
+}
+
+type Report struct {
+	Requests int64 `json:"requests"`
+	Allowed  int64 `json:"allowed"`
+	Rejected int64 `json:"rejected"`
+	// Blocked - banned or blocked by overrides requests
+	Blocked int64 `json:"blocked"`
+	Errors  int64 `json:"errors"`
+	// Unlimited - allowed requests without matched rule
+	Unlimited  int64         `json:"unlimited"`
+	Duration   time.Duration `json:"duration"`
+	Throughput float64       `json:"throughput"`
+	Latency    Latency       `json:"latency"`
+	Accuracy   Accuracy      `json:"accuracy"`
+}
+
+// checkResponse is a response of the check api, see server.HandleCheck
+type checkResponse struct {
+	Allowed bool   `json:"allowed"`
+	Banned  bool   `json:"banned"`
+	Blocked bool   `json:"blocked"`
+	Rule    string `json:"rule"`
+	Limit   int64  `json:"limit"`
+	ResetAt string `json:"reset_at"`
+}
+
+type window struct {
+	key, rule, resetAt string
+}
+
+type windowStats struct {
+	limit, sent, allowed int64
+}
+
+// Run sends check requests to the limiter until cfg.Duration is passed or cfg.Requests are sent.
+// Keys are unique for every run, so counters of previous runs don't affect the accuracy
+func Run(ctx context.Context, cfg Config, client *http.Client) (Report, error) {
+	var report Report
+
+	if cfg.Distribution == "" {
+		cfg.Distribution = DistributionUniform
+	}
+	if cfg.ZipfS == 0 {
+		cfg.ZipfS = DefaultZipfS
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return report, err
+	}
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	seed := time.Now().UnixNano()
+	keys := newKeyGenerator(cfg.Distribution, cfg.Keys, cfg.ZipfS, seed)
+	prefix := fmt.Sprintf("bench-%x-", seed)
+
+	var limiter *rate.Limiter
+	if cfg.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(cfg.Rate), 1)
+	}
+
+	url := strings.TrimSuffix(cfg.URL, "/") + "/v1/check"
+
+	var (
+		sent      atomic.Int64
+		mu        sync.Mutex
+		latencies []time.Duration
+		windows   = make(map[window]*windowStats)
+		firstErr  error
+		wg        sync.WaitGroup
+	)
+
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var local []time.Duration
+			defer func() {
+				mu.Lock()
+				latencies = append(latencies, local...)
+				mu.Unlock()
+			}()
+
+			for ctx.Err() == nil {
+				if cfg.Requests > 0 && sent.Add(1) > cfg.Requests {
+					return
+				}
+
+				if limiter != nil && limiter.Wait(ctx) != nil {
+					return
+				}
+
+				key := prefix + keys.next()
+
+				t := time.Now()
+				res, err := check(ctx, client, url, key, cfg.Route, cfg.Cost)
+				latency := time.Since(t)
+
+				// requests interrupted by the end of the run are not counted
+				if ctx.Err() != nil {
+					return
+				}
+
+				local = append(local, latency)
+
+				mu.Lock()
+				report.Requests++
+				switch {
+				case err != nil:
+					report.Errors++
+					if firstErr == nil {
+						firstErr = err
+					}
+				case res.Banned || res.Blocked:
+					report.Blocked++
+				case res.Rule == "":
+					report.Allowed++
+					report.Unlimited++
+				default:
+					w := window{key: key, rule: res.Rule, resetAt: res.ResetAt}
+					s, ok := windows[w]
+					if !ok {
+						s = &windowStats{limit: res.Limit}
+						windows[w] = s
+					}
+
+					s.sent += cfg.Cost
+					if res.Allowed {
+						report.Allowed++
+						s.allowed += cfg.Cost
+					} else {
+						report.Rejected++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	if report.Duration > 0 {
+		report.Throughput = float64(report.Requests) / report.Duration.Seconds()
+	}
+
+	report.Latency = percentiles(latencies)
+	report.Accuracy = accuracy(windows)
+
+	if report.Requests > 0 && report.Errors == report.Requests {
+		return report, fmt.Errorf("all requests failed, first error: %v", firstErr)
+	}
+
+	return report, nil
+}
+
+func check(ctx context.Context, client *http.Client, url, key, route string, cost int64) (checkResponse, error) {
+	var res checkResponse
+
+	body, err := json.Marshal(map[string]any{"key": key, "route": route, "cost": cost})
+	if err != nil {
+		return res, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return res, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+
+	return res, err
+}
+
+func percentiles(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	at := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+
+	return Latency{
+		P50: at(0.5),
+		P90: at(0.9),
+		P99: at(0.99),
+		Max: latencies[len(latencies)-1],
+	}
+}
+
+func accuracy(windows map[window]*windowStats) Accuracy {
+	res := Accuracy{Windows: int64(len(windows)), Ratio: 1}
+
+	var sent int64
+	for _, w := range windows {
+		sent += w.sent
+
+		expected := min(w.sent, w.limit)
+		if w.allowed > expected {
+			res.OverAdmitted += w.allowed - expected
+		} else {
+			res.UnderAdmitted += expected - w.allowed
+		}
+	}
+
+	if sent > 0 {
+		res.Ratio = 1 - float64(res.OverAdmitted+res.UnderAdmitted)/float64(sent)
+	}
+
+	return res
+}
@@ -0,0 +1,69 @@
+package bench_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/bench"
+	"github.com/Harardin/rate-limit/internal/server"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	// default rules allow 1 request per second for a key
+	srv, err := server.New(log.New(log.WithLogLevel(log.ERROR)), nil)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.HandleCheck))
+	defer ts.Close()
+
+	for _, distribution := range []string{bench.DistributionUniform, bench.DistributionZipf} {
+		t.Run(distribution, func(t *testing.T) {
+			report, err := bench.Run(context.Background(), bench.Config{
+				URL:          ts.URL,
+				Route:        "/bench",
+				Concurrency:  4,
+				Keys:         5,
+				Distribution: distribution,
+				Requests:     200,
+				Cost:         1,
+			}, ts.Client())
+			require.NoError(t, err)
+
+			assert.Equal(t, int64(200), report.Requests)
+			assert.Zero(t, report.Errors)
+			assert.Equal(t, report.Requests, report.Allowed+report.Rejected)
+			assert.Positive(t, report.Rejected)
+			assert.Positive(t, report.Throughput)
+			assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+			assert.Equal(t, bench.Accuracy{Windows: report.Allowed, Ratio: 1}, report.Accuracy)
+		})
+	}
+
+	t.Run("rate", func(t *testing.T) {
+		report, err := bench.Run(context.Background(), bench.Config{
+			URL:         ts.URL,
+			Route:       "/bench",
+			Concurrency: 2,
+			Keys:        100,
+			Rate:        50,
+			Duration:    200 * time.Millisecond,
+			Cost:        1,
+		}, ts.Client())
+		require.NoError(t, err)
+
+		assert.InDelta(t, 10, report.Requests, 3)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := bench.Run(context.Background(), bench.Config{URL: ts.URL, Route: "/bench", Keys: 1, Requests: 1, Cost: 1}, ts.Client())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,49 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// Key distributions
+const (
+	DistributionUniform = "uniform"
+	DistributionZipf    = "zipf"
+)
+
+// keyGenerator return keys of the configured cardinality. Safe for concurrent use
+type keyGenerator struct {
+	mu   sync.Mutex
+	rnd  *rand.Rand
+	zipf *rand.Zipf
+	keys int
+}
+
+func newKeyGenerator(distribution string, keys int, zipfS float64, seed int64) *keyGenerator {
+	g := &keyGenerator{
+		rnd:  rand.New(rand.NewSource(seed)),
+		keys: keys,
+	}
+
+	if distribution == DistributionZipf {
+		// key-0 is the hottest key
+		g.zipf = rand.NewZipf(g.rnd, zipfS, 1, uint64(keys-1))
+	}
+
+	return g
+}
+
+func (g *keyGenerator) next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var i uint64
+	if g.zipf != nil {
+		i = g.zipf.Uint64()
+	} else {
+		i = uint64(g.rnd.Intn(g.keys))
+	}
+
+	return fmt.Sprintf("bench-key-%d", i)
+}
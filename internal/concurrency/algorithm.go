@@ -0,0 +1,97 @@
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+// Algorithm calculates the next concurrency limit from a request sample
+type Algorithm interface {
+	// Update return new limit. Dropped is set for failed or timed out requests
+	Update(limit float64, rtt time.Duration, inflight int, dropped bool) float64
+}
+
+// AIMD increases the limit by one while requests succeed and the limit is utilized,
+// and multiplies it by backoff when a request is dropped.
+type AIMD struct {
+	// Backoff - default 0.9
+	Backoff float64
+}
+
+func (a *AIMD) Update(limit float64, _ time.Duration, inflight int, dropped bool) float64 {
+	if dropped {
+		backoff := a.Backoff
+		if backoff <= 0 || backoff >= 1 {
+			backoff = 0.9
+		}
+
+		return limit * backoff
+	}
+
+	// don't grow the limit which is not used
+	if float64(inflight)*2 >= limit {
+		return limit + 1
+	}
+
+	return limit
+}
+
+// Gradient compares short term latency with the long term average, like TCP Vegas.
+// The limit shrinks when latency grows (requests are queued upstream) and grows back with a small queue allowance.
+type Gradient struct {
+	// Smoothing of limit changes - default 0.2
+	Smoothing float64
+	// Tolerance of latency growth before the limit is reduced - default 1.5
+	Tolerance float64
+	// LongWindow - amount of samples in the long term average - default 600
+	LongWindow int
+
+	longRTT float64
+}
+
+func (g *Gradient) Update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+
+	tolerance := g.Tolerance
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+
+	window := g.LongWindow
+	if window <= 0 {
+		window = 600
+	}
+
+	if dropped {
+		return limit * (1 - smoothing/2)
+	}
+
+	short := float64(rtt)
+	if short <= 0 {
+		return limit
+	}
+
+	if g.longRTT == 0 {
+		g.longRTT = short
+	} else {
+		g.longRTT += (short - g.longRTT) / float64(window)
+	}
+
+	// long term average drifts up slowly on sustained latency growth, pull it back when the limit is not utilized
+	if g.longRTT/short > 2 {
+		g.longRTT *= 0.95
+	}
+
+	if float64(inflight) < limit/2 {
+		return limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, tolerance*g.longRTT/short))
+	queue := math.Sqrt(limit)
+	next := limit*gradient + queue
+
+	return limit*(1-smoothing) + next*smoothing
+}
@@ -0,0 +1,158 @@
+package concurrency
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	AlgorithmAIMD     = "aimd"
+	AlgorithmGradient = "gradient"
+)
+
+type Config struct {
+	Enabled bool `json:"CONCURRENCY_ENABLED"`
+	// Algorithm - aimd or gradient. Default gradient
+	Algorithm    string `json:"CONCURRENCY_ALGORITHM" default:"gradient"`
+	InitialLimit int    `json:"CONCURRENCY_INITIAL_LIMIT" default:"20"`
+	MinLimit     int    `json:"CONCURRENCY_MIN_LIMIT" default:"1"`
+	MaxLimit     int    `json:"CONCURRENCY_MAX_LIMIT" default:"1000"`
+	// Requests slower than timeout are counted as dropped. In milliseconds. 0 - disabled
+	Timeout int `json:"CONCURRENCY_TIMEOUT"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Algorithm, validation.Required, validation.In(AlgorithmAIMD, AlgorithmGradient)),
+		validation.Field(&c.MinLimit, validation.Required, validation.Min(1)),
+		validation.Field(&c.MaxLimit, validation.Required, validation.Min(c.MinLimit)),
+		validation.Field(&c.InitialLimit, validation.Required, validation.Min(c.MinLimit), validation.Max(c.MaxLimit)),
+		validation.Field(&c.Timeout, validation.Min(0)),
+	)
+}
+
+// Metrics receive limit changes
+type Metrics interface {
+	SetConcurrencyLimit(limit int)
+}
+
+// Limiter limits amount of requests in flight. The limit is adjusted by the algorithm on every finished request.
+type Limiter struct {
+	algorithm Algorithm
+	metrics   Metrics
+	clock     clock.Clock
+
+	min     float64
+	max     float64
+	timeout time.Duration
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+}
+
+// NewLimiter return limiter with the configured algorithm. Metrics may be nil
+func NewLimiter(cfg Config, metrics Metrics, opts ...Option) *Limiter {
+	options := Options{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var algorithm Algorithm = &Gradient{}
+	if cfg.Algorithm == AlgorithmAIMD {
+		algorithm = &AIMD{}
+	}
+
+	l := &Limiter{
+		algorithm: algorithm,
+		metrics:   metrics,
+		clock:     options.Clock,
+		min:       float64(max(cfg.MinLimit, 1)),
+		max:       float64(max(cfg.MaxLimit, cfg.MinLimit, 1)),
+		timeout:   time.Duration(cfg.Timeout) * time.Millisecond,
+		limit:     float64(max(cfg.InitialLimit, cfg.MinLimit, 1)),
+	}
+
+	l.report()
+
+	return l
+}
+
+// Token is an acquired request slot, it must be released when the request is finished
+type Token struct {
+	l     *Limiter
+	start time.Time
+	once  sync.Once
+}
+
+// Acquire return token if the request fits in the limit
+func (l *Limiter) Acquire() (*Token, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inflight) >= math.Floor(l.limit) {
+		return nil, false
+	}
+
+	l.inflight++
+
+	return &Token{l: l, start: l.clock.Now()}, true
+}
+
+// Release finishes the request, dropped requests (errors, overload) reduce the limit
+func (t *Token) Release(dropped bool) {
+	t.once.Do(func() {
+		t.l.release(t.l.clock.Since(t.start), dropped)
+	})
+}
+
+func (l *Limiter) release(rtt time.Duration, dropped bool) {
+	if l.timeout > 0 && rtt > l.timeout {
+		dropped = true
+	}
+
+	l.mu.Lock()
+	inflight := l.inflight
+	l.inflight--
+
+	prev := int(l.limit)
+	l.limit = math.Max(l.min, math.Min(l.max, l.algorithm.Update(l.limit, rtt, inflight, dropped)))
+	changed := int(l.limit) != prev
+	l.mu.Unlock()
+
+	if changed {
+		l.report()
+	}
+}
+
+// Limit return current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// Inflight return amount of acquired tokens
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inflight
+}
+
+func (l *Limiter) report() {
+	if l.metrics != nil {
+		l.metrics.SetConcurrencyLimit(l.Limit())
+	}
+}
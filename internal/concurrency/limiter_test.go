@@ -0,0 +1,68 @@
+package concurrency_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/concurrency"
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAIMD(t *testing.T) {
+	l := concurrency.NewLimiter(concurrency.Config{Algorithm: concurrency.AlgorithmAIMD, InitialLimit: 2, MinLimit: 1, MaxLimit: 10}, nil)
+
+	t1, ok := l.Acquire()
+	require.True(t, ok)
+	t2, ok := l.Acquire()
+	require.True(t, ok)
+
+	_, ok = l.Acquire()
+	assert.False(t, ok, "limit is reached")
+
+	t1.Release(false)
+	assert.Equal(t, 3, l.Limit(), "utilized limit grows")
+
+	t2.Release(true)
+	assert.Equal(t, 2, l.Limit(), "dropped request reduces limit")
+	assert.Equal(t, 0, l.Inflight())
+
+	for i := 0; i < 20; i++ {
+		token, ok := l.Acquire()
+		require.True(t, ok)
+		token.Release(true)
+	}
+	assert.Equal(t, 1, l.Limit(), "limit is bounded by min")
+}
+
+func TestTimeout(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	l := concurrency.NewLimiter(concurrency.Config{Algorithm: concurrency.AlgorithmAIMD, InitialLimit: 5, MinLimit: 1, MaxLimit: 10, Timeout: 100}, nil, concurrency.WithClock(c))
+
+	token, ok := l.Acquire()
+	require.True(t, ok)
+
+	c.Advance(time.Second)
+	token.Release(false)
+	assert.Less(t, l.Limit(), 5, "request slower than timeout is dropped")
+}
+
+func TestGradient(t *testing.T) {
+	var g concurrency.Gradient
+
+	limit := 100.0
+	for i := 0; i < 10; i++ {
+		limit = g.Update(limit, 10*time.Millisecond, int(limit), false)
+	}
+	steady := limit
+	assert.Greater(t, steady, 100.0, "stable latency leaves room to grow")
+
+	for i := 0; i < 10; i++ {
+		limit = g.Update(limit, 100*time.Millisecond, int(limit), false)
+	}
+	assert.Less(t, limit, steady, "latency growth reduces limit")
+
+	assert.Equal(t, 10.0, g.Update(10, time.Second, 1, false), "limit which is not utilized is kept")
+}
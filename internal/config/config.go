@@ -3,8 +3,18 @@ package config
 import (
 	"fmt"
 
+	"github.com/Harardin/rate-limit/internal/admin"
+	"github.com/Harardin/rate-limit/internal/concurrency"
+	"github.com/Harardin/rate-limit/internal/control"
+	"github.com/Harardin/rate-limit/internal/events"
+	"github.com/Harardin/rate-limit/internal/fairqueue"
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/internal/shedding"
+	"github.com/Harardin/rate-limit/internal/tenant"
+	"github.com/Harardin/rate-limit/internal/usage"
 	"github.com/Harardin/rate-limit/pkg/consul"
 	"github.com/Harardin/rate-limit/pkg/hc"
+	"github.com/Harardin/rate-limit/pkg/httpserver"
 	"github.com/Harardin/rate-limit/pkg/postgres"
 	"github.com/Harardin/rate-limit/pkg/prometheus"
 	"github.com/Harardin/rate-limit/pkg/rabbitbus"
@@ -30,7 +40,17 @@ type LocalConfig struct {
 	Postgres            postgres.Config
 	Redis               redisclient.Config
 	HealthCheck         hc.Config
-	GpgPublicSignatures map[string]string `json:"GPG_PUBLIC_SIGNATURES"`
+	HTTP                httpserver.Config
+	Limiter             limiter.Config
+	Admin               admin.Config
+	Tenants             tenant.Config
+	Usage               usage.Config
+	Events              events.Config
+	Control             control.Config
+	Concurrency         concurrency.Config
+	Shedding            shedding.Config
+	FairQueue           fairqueue.Config
+	GpgPublicSignatures map[string]string `json:"GPG_PUBLIC_SIGNATURES" is_json:"true"`
 
 	// Discovery services
 	// This items will be pass to the DiscoveryConfig
@@ -72,6 +92,56 @@ func (c *LocalConfig) Validate() error {
 		return err
 	}
 
+	// Validate http server
+	if err := c.HTTP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate limiter rules
+	if err := c.Limiter.Validate(); err != nil {
+		return err
+	}
+
+	// Validate admin api
+	if err := c.Admin.Validate(); err != nil {
+		return err
+	}
+
+	// Validate tenants
+	if err := c.Tenants.Validate(); err != nil {
+		return err
+	}
+
+	// Validate usage metering
+	if err := c.Usage.Validate(); err != nil {
+		return err
+	}
+
+	// Validate limiter events
+	if err := c.Events.Validate(); err != nil {
+		return err
+	}
+
+	// Validate control queue
+	if err := c.Control.Validate(); err != nil {
+		return err
+	}
+
+	// Validate adaptive concurrency limit
+	if err := c.Concurrency.Validate(); err != nil {
+		return err
+	}
+
+	// Validate load shedding
+	if err := c.Shedding.Validate(); err != nil {
+		return err
+	}
+
+	// Validate fair queuing
+	if err := c.FairQueue.Validate(); err != nil {
+		return err
+	}
+
 	// Validate prometheus
 	if !c.Prometheus.Disabled {
 		if err := validation.ValidateStruct(
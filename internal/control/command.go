@@ -0,0 +1,46 @@
+package control
+
+import (
+	"github.com/Harardin/rate-limit/internal/limiter"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type CommandType string
+
+const (
+	// CommandSetOverride sets the override of the key, the override is propagated to all instances
+	CommandSetOverride CommandType = "set_override"
+	// CommandResetKey removes counters and the ban of the key
+	CommandResetKey CommandType = "reset_key"
+	// CommandBan bans the key for the duration
+	CommandBan CommandType = "ban"
+	// CommandReloadRules re-reads the config source and applies changed limiter rules
+	CommandReloadRules CommandType = "reload_rules"
+)
+
+// Command is a json message of the control queue, e.g.
+//
+//	{"type": "set_override", "override": {"key": "client", "action": "exempt"}, "ttl": "1h"}
+//	{"type": "reset_key", "key": "client"}
+//	{"type": "ban", "key": "client", "duration": "10m"}
+//	{"type": "reload_rules"}
+type Command struct {
+	Type     CommandType       `json:"type"`
+	Override *limiter.Override `json:"override,omitempty"`
+	// TTL of the override, used if expires_at is empty
+	TTL limiter.Duration `json:"ttl,omitempty"`
+	Key string           `json:"key,omitempty"`
+	// Duration of the ban
+	Duration limiter.Duration `json:"duration,omitempty"`
+}
+
+func (c *Command) Validate() error {
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Type, validation.Required, validation.In(CommandSetOverride, CommandResetKey, CommandBan, CommandReloadRules)),
+		validation.Field(&c.Override, validation.When(c.Type == CommandSetOverride, validation.Required)),
+		validation.Field(&c.Key, validation.When(c.Type == CommandResetKey || c.Type == CommandBan, validation.Required)),
+		validation.Field(&c.Duration, validation.When(c.Type == CommandBan, validation.Required, validation.Min(limiter.Duration(1)))),
+	)
+}
@@ -0,0 +1,193 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/admin"
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/rabbitbus"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/goccy/go-json"
+)
+
+type Config struct {
+	Enabled bool `json:"CONTROL_ENABLED"`
+	// Fanout exchange of commands, it is declared by the consumer. Every instance consumes all commands from its own queue
+	Exchange string `json:"CONTROL_EXCHANGE" default:"rate_limit.commands"`
+	Consumer string `json:"CONTROL_CONSUMER" default:"rate-limit"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Exchange, validation.Required),
+	)
+}
+
+// Overrides saves overrides, implemented by admin.Service
+type Overrides interface {
+	SetOverride(ctx context.Context, o limiter.Override) (limiter.Override, error)
+}
+
+// Consumer applies commands from the control exchange.
+//
+// Each instance receives every command, so state kept in memory (e.g. the memory store) is changed on all instances.
+// Invalid messages are rejected, messages failed with other errors are returned to the queue.
+type Consumer struct {
+	logger    log.Logger
+	clock     clock.Clock
+	bus       *rabbitbus.Service
+	limiter   *limiter.Limiter
+	overrides Overrides
+	reload    func() error
+
+	exchange string
+	consumer string
+}
+
+// NewConsumer return consumer of the control exchange. Overrides may be nil if the admin api is disabled,
+// reload re-reads limiter rules from the config source.
+func NewConsumer(logger log.Logger, bus *rabbitbus.Service, l *limiter.Limiter, overrides Overrides, reload func() error, cfg Config, opts ...Option) *Consumer {
+	c := &Consumer{
+		logger:    logger,
+		clock:     clock.Real{},
+		bus:       bus,
+		limiter:   l,
+		overrides: overrides,
+		reload:    reload,
+		exchange:  cfg.Exchange,
+		consumer:  cfg.Consumer,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Start consumes commands until ctx is done, reconnects the reader if it stops
+func (c *Consumer) Start(ctx context.Context) {
+	for {
+		if err := c.consume(ctx); err != nil {
+			c.logger.Errorf("failed to consume control commands: %v", err)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-c.clock.After(time.Second * 5):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Consumer) consume(ctx context.Context) error {
+	r, err := c.bus.NewFanoutReader(ctx, c.exchange, c.consumer)
+	if err != nil {
+		return err
+	}
+
+	for m := range r.ReceiveMsg() {
+		err := c.Handle(ctx, m.Read())
+
+		switch {
+		case err == nil:
+			if err := m.Ack(); err != nil {
+				c.logger.Errorf("failed to ack control command: %v", err)
+			}
+		case errors.Is(err, ErrInvalidCommand):
+			c.logger.Warnf("control command is rejected: %v", err)
+
+			if err := m.Reject(); err != nil {
+				c.logger.Errorf("failed to reject control command: %v", err)
+			}
+		default:
+			c.logger.Errorf("failed to apply control command: %v", err)
+
+			// don't redeliver failing commands in a busy loop
+			select {
+			case <-c.clock.After(time.Second):
+			case <-ctx.Done():
+			}
+
+			if err := m.Nack(); err != nil {
+				c.logger.Errorf("failed to nack control command: %v", err)
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return fmt.Errorf("reader of exchange \"%s\" is stopped", c.exchange)
+}
+
+// Handle decodes, validates and applies the command
+func (c *Consumer) Handle(ctx context.Context, data []byte) error {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return errors.Join(ErrInvalidCommand, err)
+	}
+
+	if cmd.Override != nil && cmd.Override.ExpiresAt.IsZero() && cmd.TTL > 0 {
+		cmd.Override.ExpiresAt = c.limiter.Now().Add(time.Duration(cmd.TTL))
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.Join(ErrInvalidCommand, err)
+	}
+
+	return c.Apply(ctx, cmd)
+}
+
+func (c *Consumer) Apply(ctx context.Context, cmd Command) error {
+	switch cmd.Type {
+	case CommandSetOverride:
+		if c.overrides == nil {
+			return errors.Join(ErrInvalidCommand, errors.New("overrides require admin api"))
+		}
+
+		_, err := c.overrides.SetOverride(ctx, *cmd.Override)
+		if errors.Is(err, admin.ErrValidation) {
+			return errors.Join(ErrInvalidCommand, err)
+		}
+
+		return err
+	case CommandResetKey:
+		if err := c.limiter.Reset(ctx, cmd.Key); err != nil {
+			return err
+		}
+
+		c.logger.Infof("counters of key \"%s\" were reset by control command", cmd.Key)
+	case CommandBan:
+		p := c.limiter.Penalizer()
+		if p == nil {
+			return errors.Join(ErrInvalidCommand, errors.New("penalties are disabled"))
+		}
+
+		if err := p.Ban(ctx, cmd.Key, time.Duration(cmd.Duration)); err != nil {
+			return err
+		}
+
+		c.logger.Infof("key \"%s\" is banned for %s by control command", cmd.Key, time.Duration(cmd.Duration))
+	case CommandReloadRules:
+		return c.reload()
+	}
+
+	return nil
+}
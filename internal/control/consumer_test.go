@@ -0,0 +1,68 @@
+package control_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/control"
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type overridesMock []limiter.Override
+
+func (m *overridesMock) SetOverride(_ context.Context, o limiter.Override) (limiter.Override, error) {
+	*m = append(*m, o)
+	return o, nil
+}
+
+func TestHandle(t *testing.T) {
+	store := limiter.NewMemoryStore(0)
+	defer store.Close()
+
+	p, err := limiter.NewPenalizer(store, limiter.PenaltyConfig{Enabled: true, Violations: 10, Window: 60, BanDurations: []string{"1m"}, Memory: 60})
+	require.NoError(t, err)
+
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	l := limiter.New(nil, store, limiter.DefaultRules(), limiter.WithPenalizer(p), limiter.WithClock(c))
+
+	var reloaded int
+	var overrides overridesMock
+	consumer := control.NewConsumer(log.New(), nil, l, &overrides, func() error {
+		reloaded++
+		return nil
+	}, control.Config{Exchange: "commands"})
+
+	ctx := context.Background()
+
+	require.NoError(t, consumer.Handle(ctx, []byte(`{"type": "set_override", "override": {"key": "client", "action": "exempt"}, "ttl": "1h"}`)))
+	require.Len(t, overrides, 1)
+	assert.Equal(t, c.Now().Add(time.Hour), overrides[0].ExpiresAt)
+
+	require.NoError(t, consumer.Handle(ctx, []byte(`{"type": "ban", "key": "client", "duration": "10m"}`)))
+	d, err := l.Check(ctx, limiter.Request{Key: "client"})
+	require.NoError(t, err)
+	assert.True(t, d.Banned)
+
+	require.NoError(t, consumer.Handle(ctx, []byte(`{"type": "reset_key", "key": "client"}`)))
+	d, err = l.Check(ctx, limiter.Request{Key: "client"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+
+	require.NoError(t, consumer.Handle(ctx, []byte(`{"type": "reload_rules"}`)))
+	assert.Equal(t, 1, reloaded)
+
+	for _, msg := range []string{
+		`not json`,
+		`{"type": "unknown"}`,
+		`{"type": "ban", "key": "client"}`,
+		`{"type": "set_override", "override": {"key": "client", "action": "exempt"}}`,
+	} {
+		assert.ErrorIs(t, consumer.Handle(ctx, []byte(msg)), control.ErrInvalidCommand, msg)
+	}
+}
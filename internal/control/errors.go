@@ -0,0 +1,6 @@
+package control
+
+import "errors"
+
+// ErrInvalidCommand is returned for commands which can't be applied on retry, such messages are rejected
+var ErrInvalidCommand = errors.New("invalid command")
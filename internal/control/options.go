@@ -0,0 +1,12 @@
+package control
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(c *Consumer)
+
+// WithClock - clock of reconnects and redelivery delays. Default clock.Real
+func WithClock(v clock.Clock) Option {
+	return func(c *Consumer) {
+		c.clock = v
+	}
+}
@@ -0,0 +1,221 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/goccy/go-json"
+)
+
+type Config struct {
+	Enabled  bool   `json:"EVENTS_ENABLED"`
+	Exchange string `json:"EVENTS_EXCHANGE" default:"rate_limit.events"`
+	// Pending events are published every flush interval. In seconds. Default 5 seconds
+	FlushInterval int `json:"EVENTS_FLUSH_INTERVAL" default:"5"`
+	// Events of the same type, key and rule are published at most once per dedup window. In seconds. Default 60 seconds
+	DedupWindow int `json:"EVENTS_DEDUP_WINDOW" default:"60"`
+	// Max distinct pending events, new events are dropped when the limit is reached
+	MaxPending int `json:"EVENTS_MAX_PENDING" default:"10000"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Exchange, validation.Required),
+		validation.Field(&c.FlushInterval, validation.Required, validation.Min(1)),
+		validation.Field(&c.DedupWindow, validation.Min(0)),
+		validation.Field(&c.MaxPending, validation.Required, validation.Min(1)),
+	)
+}
+
+// RoutingKey return routing key of the event type, e.g. rate_limit.throttled
+func RoutingKey(t limiter.EventType) string {
+	return "rate_limit." + string(t)
+}
+
+// Writer publishes messages, implemented by rabbitbus.Writer
+type Writer interface {
+	WriteToExchange(ctx context.Context, exchangeName, routingKey string, data []byte) error
+}
+
+// Message is a published event. Count is the number of merged events since FirstTime
+type Message struct {
+	limiter.Event
+	Count     int64     `json:"count"`
+	FirstTime time.Time `json:"first_time"`
+}
+
+type dedupKey struct {
+	typ  limiter.EventType
+	key  string
+	rule string
+}
+
+// Publisher collects limiter events and publishes them in batches. Repeated events of the same type, key and rule
+// are merged into one message with a count, so a flood of 429s is published as one message per dedup window.
+//
+// Publisher implements limiter.EventPublisher.
+type Publisher struct {
+	logger log.Logger
+	writer Writer
+	clock  clock.Clock
+
+	exchange      string
+	flushInterval time.Duration
+	dedupWindow   time.Duration
+	maxPending    int
+
+	mu      sync.Mutex
+	pending map[dedupKey]*Message
+	sent    map[dedupKey]time.Time
+}
+
+func NewPublisher(logger log.Logger, writer Writer, cfg Config, opts ...Option) *Publisher {
+	flushInterval := time.Duration(cfg.FlushInterval) * time.Second
+	if flushInterval == 0 {
+		flushInterval = 5 * time.Second
+	}
+
+	maxPending := cfg.MaxPending
+	if maxPending == 0 {
+		maxPending = 10000
+	}
+
+	p := &Publisher{
+		logger:        logger,
+		writer:        writer,
+		clock:         clock.Real{},
+		exchange:      cfg.Exchange,
+		flushInterval: flushInterval,
+		dedupWindow:   time.Duration(cfg.DedupWindow) * time.Second,
+		maxPending:    maxPending,
+		pending:       make(map[dedupKey]*Message),
+		sent:          make(map[dedupKey]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// SetWriter replaces the writer, e.g. after rabbitmq reconnection. Must not be called while Start is running
+func (p *Publisher) SetWriter(w Writer) {
+	p.writer = w
+}
+
+// PublishEvent adds the event to the batch
+func (p *Publisher) PublishEvent(e limiter.Event) {
+	k := dedupKey{typ: e.Type, key: e.Key, rule: e.Rule}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if m, ok := p.pending[k]; ok {
+		m.Event = e
+		m.Count++
+		return
+	}
+
+	if len(p.pending) >= p.maxPending {
+		return
+	}
+
+	p.pending[k] = &Message{Event: e, Count: 1, FirstTime: e.Time}
+}
+
+// Start publishes events every flush interval until ctx is done, then publishes all pending events
+func (p *Publisher) Start(ctx context.Context) {
+	ticker := p.clock.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			p.Flush(ctx, p.clock.Now())
+		case <-ctx.Done():
+			// ctx is done, use a new one for the last flush. Events deduplicated within the window are published too,
+			// otherwise they are lost on stop
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			p.flush(flushCtx, p.clock.Now(), true)
+			cancel()
+
+			return
+		}
+	}
+}
+
+// Flush publishes pending events which were not published within the dedup window.
+// Events failed to publish are kept until the next flush.
+func (p *Publisher) Flush(ctx context.Context, now time.Time) {
+	p.flush(ctx, now, false)
+}
+
+// flush publishes pending events, all of them if force is set
+func (p *Publisher) flush(ctx context.Context, now time.Time, force bool) {
+	for k, m := range p.ready(now, force) {
+		data, err := json.Marshal(m)
+		if err != nil {
+			p.logger.Errorf("failed to marshal event: %v", err)
+			continue
+		}
+
+		if err := p.writer.WriteToExchange(ctx, p.exchange, RoutingKey(m.Type), data); err != nil {
+			p.logger.Errorf("failed to publish %s event of key \"%s\": %v", m.Type, m.Key, err)
+			p.requeue(k, m)
+			continue
+		}
+
+		p.mu.Lock()
+		p.sent[k] = now
+		p.mu.Unlock()
+	}
+}
+
+// ready removes events ready to publish from pending
+func (p *Publisher) ready(now time.Time, force bool) map[dedupKey]*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, t := range p.sent {
+		if now.Sub(t) >= p.dedupWindow {
+			delete(p.sent, k)
+		}
+	}
+
+	res := make(map[dedupKey]*Message)
+	for k, m := range p.pending {
+		if _, ok := p.sent[k]; ok && !force {
+			continue
+		}
+
+		res[k] = m
+		delete(p.pending, k)
+	}
+
+	return res
+}
+
+func (p *Publisher) requeue(k dedupKey, m *Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cur, ok := p.pending[k]; ok {
+		cur.Count += m.Count
+		cur.FirstTime = m.FirstTime
+		return
+	}
+
+	p.pending[k] = m
+}
@@ -0,0 +1,116 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/events"
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type writerMock struct {
+	mu       sync.Mutex
+	err      error
+	messages map[string][]events.Message
+}
+
+func (w *writerMock) WriteToExchange(_ context.Context, _, routingKey string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	var m events.Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	w.messages[routingKey] = append(w.messages[routingKey], m)
+
+	return nil
+}
+
+func (w *writerMock) count(routingKey string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.messages[routingKey])
+}
+
+func TestPublisher(t *testing.T) {
+	w := &writerMock{messages: make(map[string][]events.Message)}
+	p := events.NewPublisher(log.New(), w, events.Config{Exchange: "events", FlushInterval: 1, DedupWindow: 60, MaxPending: 100})
+
+	now := time.Now()
+	throttled := limiter.Event{Type: limiter.EventThrottled, Time: now, Key: "client", Rule: "strict"}
+
+	for i := 0; i < 100; i++ {
+		p.PublishEvent(throttled)
+	}
+	p.PublishEvent(limiter.Event{Type: limiter.EventBanned, Time: now, Key: "client"})
+
+	p.Flush(context.Background(), now)
+
+	require.Len(t, w.messages["rate_limit.throttled"], 1)
+	assert.Equal(t, int64(100), w.messages["rate_limit.throttled"][0].Count)
+	require.Len(t, w.messages["rate_limit.banned"], 1)
+
+	t.Run("deduplicate within window", func(t *testing.T) {
+		p.PublishEvent(throttled)
+		p.Flush(context.Background(), now.Add(time.Second))
+		assert.Len(t, w.messages["rate_limit.throttled"], 1)
+
+		p.PublishEvent(throttled)
+		p.Flush(context.Background(), now.Add(time.Minute))
+		require.Len(t, w.messages["rate_limit.throttled"], 2)
+		assert.Equal(t, int64(2), w.messages["rate_limit.throttled"][1].Count)
+	})
+
+	t.Run("keep events failed to publish", func(t *testing.T) {
+		w.err = errors.New("connection closed")
+		p.PublishEvent(limiter.Event{Type: limiter.EventQuotaWarning, Time: now, Key: "client", Rule: "daily"})
+		p.Flush(context.Background(), now)
+
+		w.err = nil
+		p.Flush(context.Background(), now)
+		assert.Len(t, w.messages["rate_limit.quota_warning"], 1)
+	})
+}
+
+func TestPublisherStart(t *testing.T) {
+	w := &writerMock{messages: make(map[string][]events.Message)}
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	p := events.NewPublisher(log.New(), w, events.Config{Exchange: "events", FlushInterval: 1, DedupWindow: 60, MaxPending: 100}, events.WithClock(c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+	throttled := limiter.Event{Type: limiter.EventThrottled, Time: c.Now(), Key: "client", Rule: "strict"}
+	p.PublishEvent(throttled)
+	c.Advance(time.Second)
+	require.Eventually(t, func() bool { return w.count("rate_limit.throttled") == 1 }, time.Second, time.Millisecond)
+
+	// deduplicated within the window, but must not be lost on stop
+	p.PublishEvent(throttled)
+	c.Advance(time.Second)
+
+	cancel()
+	<-done
+	assert.Equal(t, 2, w.count("rate_limit.throttled"))
+}
@@ -0,0 +1,12 @@
+package events
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(p *Publisher)
+
+// WithClock - clock of flushes and the dedup window. Default clock.Real
+func WithClock(c clock.Clock) Option {
+	return func(p *Publisher) {
+		p.clock = c
+	}
+}
@@ -0,0 +1,8 @@
+package fairqueue
+
+import "errors"
+
+var (
+	ErrQueueFull    = errors.New("tenant queue is full")
+	ErrQueueTimeout = errors.New("queue timeout")
+)
@@ -0,0 +1,266 @@
+package fairqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	Enabled bool `json:"FAIR_QUEUE_ENABLED"`
+	// Capacity - requests in flight shared by all tenants. Default 100
+	Capacity int `json:"FAIR_QUEUE_CAPACITY" default:"100"`
+	// MaxQueue - waiting requests per tenant. Default 50
+	MaxQueue int `json:"FAIR_QUEUE_MAX_QUEUE" default:"50"`
+	// Timeout of waiting in the queue. In milliseconds. Default 1000
+	Timeout int `json:"FAIR_QUEUE_TIMEOUT" default:"1000"`
+	// Weights - list of tenant id or "plan:<name>" and weight, e.g. "42=4,plan:pro=2". Default weight is 1
+	Weights []string `json:"FAIR_QUEUE_WEIGHTS"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if err := validation.ValidateStruct(
+		c,
+		validation.Field(&c.Capacity, validation.Required, validation.Min(1)),
+		validation.Field(&c.MaxQueue, validation.Required, validation.Min(1)),
+		validation.Field(&c.Timeout, validation.Required, validation.Min(1)),
+	); err != nil {
+		return err
+	}
+
+	_, err := c.GetWeights()
+	return err
+}
+
+// GetWeights return parsed weights by tenant id or "plan:<name>"
+func (c *Config) GetWeights() (map[string]int, error) {
+	res := make(map[string]int, len(c.Weights))
+	for _, v := range c.Weights {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		name, weight, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad weight \"%s\", expected tenant=weight", v)
+		}
+
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("bad weight \"%s\", weight must be a positive integer", v)
+		}
+
+		res[name] = w
+	}
+
+	return res, nil
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+type tenantQueue struct {
+	name    string
+	weight  int
+	deficit int
+	waiters []*waiter
+}
+
+// Scheduler shares capacity between tenants with deficit round robin.
+//
+// While capacity is available requests are admitted immediately. When it is saturated requests wait
+// in bounded per tenant queues, and free slots are given to tenants in turn proportionally to their weights,
+// so a noisy tenant can't starve others.
+type Scheduler struct {
+	capacity int
+	maxQueue int
+	timeout  time.Duration
+	clock    clock.Clock
+
+	mu       sync.Mutex
+	inflight int
+	tenants  map[string]*tenantQueue
+	// active - tenants with waiting requests in round robin order
+	active []*tenantQueue
+	next   int
+}
+
+func NewScheduler(cfg Config, opts ...Option) *Scheduler {
+	options := Options{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Millisecond
+	if timeout == 0 {
+		timeout = time.Second
+	}
+
+	return &Scheduler{
+		capacity: max(cfg.Capacity, 1),
+		maxQueue: max(cfg.MaxQueue, 1),
+		timeout:  timeout,
+		clock:    options.Clock,
+		tenants:  make(map[string]*tenantQueue),
+	}
+}
+
+// Acquire waits for a slot of the tenant. Release must be called when the request is finished
+func (s *Scheduler) Acquire(ctx context.Context, tenant string, weight int) (func(), error) {
+	s.mu.Lock()
+
+	if s.inflight < s.capacity && len(s.active) == 0 {
+		s.inflight++
+		s.mu.Unlock()
+
+		return s.releaseFunc(), nil
+	}
+
+	tq, ok := s.tenants[tenant]
+	if !ok {
+		tq = &tenantQueue{name: tenant}
+		s.tenants[tenant] = tq
+	}
+	tq.weight = max(weight, 1)
+
+	if len(tq.waiters) >= s.maxQueue {
+		s.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	tq.waiters = append(tq.waiters, w)
+	if len(tq.waiters) == 1 {
+		s.active = append(s.active, tq)
+	}
+
+	s.mu.Unlock()
+
+	timeout := s.clock.After(s.timeout)
+
+	var err error
+	select {
+	case <-w.ready:
+		return s.releaseFunc(), nil
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the slot was granted concurrently with the timeout
+	if w.granted {
+		return s.releaseFunc(), nil
+	}
+
+	s.remove(tq, w)
+
+	return nil, err
+}
+
+func (s *Scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(s.release)
+	}
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight--
+	s.dispatch()
+}
+
+// dispatch gives free slots to waiting requests, must be called under lock
+func (s *Scheduler) dispatch() {
+	for s.inflight < s.capacity && len(s.active) > 0 {
+		if s.next >= len(s.active) {
+			s.next = 0
+		}
+
+		tq := s.active[s.next]
+		if tq.deficit < 1 {
+			tq.deficit += tq.weight
+		}
+
+		w := tq.waiters[0]
+		tq.waiters = tq.waiters[1:]
+		tq.deficit--
+
+		w.granted = true
+		close(w.ready)
+		s.inflight++
+
+		switch {
+		case len(tq.waiters) == 0:
+			s.deactivate(s.next)
+		case tq.deficit < 1:
+			s.next++
+		}
+	}
+}
+
+// remove removes the waiter which is timed out, must be called under lock
+func (s *Scheduler) remove(tq *tenantQueue, w *waiter) {
+	for i := range tq.waiters {
+		if tq.waiters[i] == w {
+			tq.waiters = append(tq.waiters[:i], tq.waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(tq.waiters) > 0 {
+		return
+	}
+
+	for i := range s.active {
+		if s.active[i] == tq {
+			s.deactivate(i)
+			return
+		}
+	}
+}
+
+// deactivate removes the tenant without waiting requests from the round robin
+func (s *Scheduler) deactivate(i int) {
+	tq := s.active[i]
+	tq.deficit = 0
+	delete(s.tenants, tq.name)
+
+	s.active = append(s.active[:i], s.active[i+1:]...)
+	if i < s.next {
+		s.next--
+	}
+}
+
+// Stats return requests in flight and waiting requests by tenant
+func (s *Scheduler) Stats() (int, map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waiting := make(map[string]int, len(s.active))
+	for _, tq := range s.active {
+		waiting[tq.name] = len(tq.waiters)
+	}
+
+	return s.inflight, waiting
+}
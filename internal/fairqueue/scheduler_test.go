@@ -0,0 +1,98 @@
+package fairqueue_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/fairqueue"
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	s := fairqueue.NewScheduler(fairqueue.Config{Capacity: 1, MaxQueue: 10, Timeout: 5000})
+
+	release, err := s.Acquire(context.Background(), "holder", 1)
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+
+	enqueue := func(tenant string, weight, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				release, err := s.Acquire(context.Background(), tenant, weight)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				mu.Lock()
+				order = append(order, tenant)
+				mu.Unlock()
+
+				release()
+			}()
+		}
+
+		require.Eventually(t, func() bool {
+			_, waiting := s.Stats()
+			return waiting[tenant] == n
+		}, time.Second, time.Millisecond)
+	}
+
+	enqueue("noisy", 3, 8)
+	enqueue("quiet", 1, 3)
+
+	release()
+	wg.Wait()
+
+	assert.Equal(t, []string{
+		"noisy", "noisy", "noisy", "quiet",
+		"noisy", "noisy", "noisy", "quiet",
+		"noisy", "noisy", "quiet",
+	}, order)
+
+	inflight, waiting := s.Stats()
+	assert.Equal(t, 0, inflight)
+	assert.Empty(t, waiting)
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	s := fairqueue.NewScheduler(fairqueue.Config{Capacity: 1, MaxQueue: 1, Timeout: 20}, fairqueue.WithClock(c))
+
+	release, err := s.Acquire(context.Background(), "a", 1)
+	require.NoError(t, err)
+	defer release()
+
+	done := make(chan error)
+	go func() {
+		_, err := s.Acquire(context.Background(), "a", 1)
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		_, waiting := s.Stats()
+		return waiting["a"] == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = s.Acquire(context.Background(), "a", 1)
+	assert.ErrorIs(t, err, fairqueue.ErrQueueFull)
+
+	require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+	c.Advance(20 * time.Millisecond)
+	assert.ErrorIs(t, <-done, fairqueue.ErrQueueTimeout)
+
+	_, waiting := s.Stats()
+	assert.Empty(t, waiting)
+}
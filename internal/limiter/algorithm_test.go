@@ -0,0 +1,97 @@
+package limiter_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlgorithmBoundaries(t *testing.T) {
+	at := func(v string) time.Time {
+		res, err := time.Parse(time.RFC3339Nano, v)
+		require.NoError(t, err)
+		return res
+	}
+
+	type step struct {
+		at        string
+		allowed   bool
+		remaining int64
+		resetAt   string
+		retry     time.Duration
+	}
+
+	tt := []struct {
+		name  string
+		rule  string
+		steps []step
+	}{
+		{
+			name: "fixed window",
+			rule: `{"name": "r", "limit": 2, "window": "1m"}`,
+			steps: []step{
+				{at: "2024-05-01T10:00:00Z", allowed: true, remaining: 1, resetAt: "2024-05-01T10:01:00Z"},
+				{at: "2024-05-01T10:00:30Z", allowed: true, remaining: 0, resetAt: "2024-05-01T10:01:00Z"},
+				{at: "2024-05-01T10:00:59.999Z", resetAt: "2024-05-01T10:01:00Z", retry: time.Millisecond},
+				{at: "2024-05-01T10:01:00Z", allowed: true, remaining: 1, resetAt: "2024-05-01T10:02:00Z"},
+			},
+		},
+		{
+			name: "sliding window",
+			rule: `{"name": "r", "limit": 2, "window": "1m", "algorithm": "sliding_window"}`,
+			steps: []step{
+				{at: "2024-05-01T10:00:00Z", allowed: true, remaining: 1, resetAt: "2024-05-01T10:01:00Z"},
+				{at: "2024-05-01T10:00:30Z", allowed: true, remaining: 0, resetAt: "2024-05-01T10:01:00Z"},
+				{at: "2024-05-01T10:00:59Z", resetAt: "2024-05-01T10:01:00Z", retry: time.Second},
+				// the previous window has full weight at the start of the window, its share drops to 1 in 30 seconds
+				{at: "2024-05-01T10:01:00Z", resetAt: "2024-05-01T10:02:00Z", retry: 30 * time.Second},
+				{at: "2024-05-01T10:01:30Z", allowed: true, remaining: 0, resetAt: "2024-05-01T10:02:00Z"},
+				{at: "2024-05-01T10:01:31Z", resetAt: "2024-05-01T10:02:00Z", retry: 29 * time.Second},
+				{at: "2024-05-01T10:02:00Z", allowed: true, remaining: 0, resetAt: "2024-05-01T10:03:00Z"},
+			},
+		},
+		{
+			name: "calendar day in the rule time zone",
+			rule: `{"name": "r", "limit": 1, "algorithm": "calendar_day", "time_zone": "Asia/Tokyo"}`,
+			steps: []step{
+				{at: "2024-05-01T14:59:59Z", allowed: true, remaining: 0, resetAt: "2024-05-01T15:00:00Z"},
+				{at: "2024-05-01T14:59:59.5Z", resetAt: "2024-05-01T15:00:00Z", retry: 500 * time.Millisecond},
+				{at: "2024-05-01T15:00:00Z", allowed: true, remaining: 0, resetAt: "2024-05-02T15:00:00Z"},
+			},
+		},
+		{
+			name: "calendar month",
+			rule: `{"name": "r", "limit": 1, "algorithm": "calendar_month"}`,
+			steps: []step{
+				{at: "2024-02-29T23:59:59Z", allowed: true, remaining: 0, resetAt: "2024-03-01T00:00:00Z"},
+				{at: "2024-02-29T23:59:59.999Z", resetAt: "2024-03-01T00:00:00Z", retry: time.Millisecond},
+				{at: "2024-03-01T00:00:00Z", allowed: true, remaining: 0, resetAt: "2024-04-01T00:00:00Z"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newTestLimiter(t, "["+tc.rule+"]")
+
+			for i, s := range tc.steps {
+				l.clock.Set(at(s.at))
+
+				d, err := l.Check(context.Background(), limiter.Request{Key: "127.0.0.1"})
+				require.NoError(t, err)
+
+				msg := fmt.Sprintf("step %d at %s", i, s.at)
+				assert.Equal(t, s.allowed, d.Allowed, msg)
+				assert.Equal(t, s.remaining, d.Remaining, msg)
+				assert.Equal(t, at(s.resetAt), d.ResetAt.UTC(), msg)
+				assert.Equal(t, s.retry, d.RetryAfter, msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package limiter
+
+import "time"
+
+type EventType string
+
+const (
+	// EventThrottled - request of the key is rejected with 429
+	EventThrottled EventType = "throttled"
+	// EventBanned - the key is banned for repeated violations
+	EventBanned EventType = "banned"
+	// EventQuotaWarning - the key used 80% of the rule quota
+	EventQuotaWarning EventType = "quota_warning"
+	// EventQuotaExhausted - the key used 100% of the rule quota
+	EventQuotaExhausted EventType = "quota_exhausted"
+)
+
+// quotaWarningRatio is the share of the quota used when EventQuotaWarning is published
+const quotaWarningRatio = 0.8
+
+type Event struct {
+	Type   EventType `json:"type"`
+	Time   time.Time `json:"time"`
+	Key    string    `json:"key"`
+	Tenant string    `json:"tenant,omitempty"`
+	Route  string    `json:"route,omitempty"`
+	// Rule is empty for EventBanned
+	Rule  string `json:"rule,omitempty"`
+	Limit int64  `json:"limit,omitempty"`
+	Used  int64  `json:"used,omitempty"`
+	// ResetAt - end of the quota window or the ban
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// EventPublisher receive limiter events. PublishEvent is called on the request path and must not block
+type EventPublisher interface {
+	PublishEvent(e Event)
+}
+
+// quotaEvent return the threshold event if the allowed request crossed 80% or 100% of the quota
+func quotaEvent(t take, key string, cost int64, now time.Time) (Event, bool) {
+	limit := t.rule.Limit
+	used := limit - t.remaining
+	before := used - cost
+
+	e := Event{
+		Time:    now,
+		Key:     key,
+		Rule:    t.rule.Name,
+		Limit:   limit,
+		Used:    used,
+		ResetAt: t.resetAt,
+	}
+
+	warning := int64(float64(limit) * quotaWarningRatio)
+
+	switch {
+	case used >= limit && before < limit:
+		e.Type = EventQuotaExhausted
+	case used >= warning && before < warning:
+		e.Type = EventQuotaWarning
+	default:
+		return e, false
+	}
+
+	return e, true
+}
+
+func (l *Limiter) publish(e Event, req *Request) {
+	if l.events == nil {
+		return
+	}
+
+	e.Tenant = req.Attrs[AttrTenant]
+	e.Route = req.Route
+
+	l.events.PublishEvent(e)
+}
@@ -0,0 +1,584 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	StoreMemory   = "memory"
+	StoreRedis    = "redis"
+	StorePostgres = "postgres"
+)
+
+type Config struct {
+	// Rules - json list of rules, see Rule. If empty DefaultRules are used
+	Rules string `json:"RATE_LIMIT_RULES"`
+	// Store - memory, redis or postgres. Default memory
+	Store   string `json:"RATE_LIMIT_STORE" default:"memory"`
+	Penalty PenaltyConfig
+}
+
+func (c *Config) Validate() error {
+	if err := validation.ValidateStruct(
+		c,
+		validation.Field(&c.Store, validation.In(StoreMemory, StoreRedis, StorePostgres)),
+	); err != nil {
+		return err
+	}
+
+	if err := c.Penalty.Validate(); err != nil {
+		return err
+	}
+
+	_, err := ParseRules(c.Rules)
+	return err
+}
+
+// GetRules return parsed rules or DefaultRules if rules are not configured
+func (c *Config) GetRules() ([]Rule, error) {
+	rules, err := ParseRules(c.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rules) == 0 {
+		return DefaultRules(), nil
+	}
+
+	return rules, nil
+}
+
+// Request attributes set by the limiter, can be used in Rule.KeyBy
+const (
+	AttrAPIKey = "api_key"
+	AttrTenant = "tenant"
+)
+
+// Plan is the set of limits of a tenant
+type Plan struct {
+	Tenant string
+	Name   string
+	// Limits by rule name, rules missing in the plan use their own limit
+	Limits map[string]int64
+	// TimeZone of calendar windows, has priority over the rule time zone
+	TimeZone string
+	// Priority of requests under overload, see shedding package
+	Priority string
+}
+
+// PlanResolver return the plan of the tenant owning the api key
+type PlanResolver interface {
+	ResolvePlan(apiKey string) (Plan, bool)
+}
+
+// TenantPlanResolver is implemented by plan resolvers which can find the plan by tenant,
+// so Inspect uses the tenant time zone for rules keyed by tenant
+type TenantPlanResolver interface {
+	ResolveTenantPlan(tenant string) (Plan, bool)
+}
+
+// Usage is consumption of a single checked request
+type Usage struct {
+	Time    time.Time
+	Tenant  string
+	Key     string
+	Route   string
+	Allowed bool
+	Cost    int64
+}
+
+// UsageRecorder receive every checked request
+type UsageRecorder interface {
+	RecordUsage(u Usage)
+}
+
+// Metrics receive every rule evaluation
+type Metrics interface {
+	IncrementLimiterDecision(rule, mode, result string)
+}
+
+type Request struct {
+	// Key is a caller identity used by rules without KeyBy, e.g. client ip
+	Key string
+	// APIKey is used to resolve the tenant plan
+	APIKey string
+	Route  string
+	// Cost - default 1
+	Cost int64
+	// Attrs are additional request attributes which can be used as keys with Rule.KeyBy
+	Attrs map[string]string
+}
+
+func (r *Request) Validate() error {
+	return validation.ValidateStruct(
+		r,
+		validation.Field(&r.Key, validation.Required),
+		validation.Field(&r.Cost, validation.Min(int64(0))),
+	)
+}
+
+func (r *Request) keyFor(rule Rule) string {
+	if rule.KeyBy == "" {
+		return r.Key
+	}
+
+	return r.Attrs[rule.KeyBy]
+}
+
+type Decision struct {
+	Allowed bool
+	// Banned is set when the key is banned for repeated violations
+	Banned bool
+	// Blocked is set when the key is blocked by an override
+	Blocked bool
+	// Rule which made the decision: the rejecting rule or the enforced rule with the least remaining quota
+	Rule      string
+	Limit     int64
+	Remaining int64
+	ResetAt   time.Time
+	// RetryAfter is set for rejected requests
+	RetryAfter time.Duration
+	// Shadow - shadow rules which would reject the request
+	Shadow []string
+}
+
+type Limiter struct {
+	logger    log.Logger
+	store     Store
+	metrics   Metrics
+	penalizer *Penalizer
+	plans     PlanResolver
+	usage     UsageRecorder
+	events    EventPublisher
+	clock     clock.Clock
+
+	rules     atomic.Pointer[[]Rule]
+	overrides atomic.Pointer[map[string][]Override]
+}
+
+func New(logger log.Logger, store Store, rules []Rule, opts ...Option) *Limiter {
+	options := Options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	l := &Limiter{
+		logger:    logger,
+		store:     store,
+		metrics:   options.Metrics,
+		penalizer: options.Penalizer,
+		plans:     options.Plans,
+		usage:     options.Usage,
+		events:    options.Events,
+		clock:     options.Clock,
+	}
+
+	if l.clock == nil {
+		l.clock = clock.Real{}
+	}
+
+	l.SetRules(rules)
+
+	return l
+}
+
+// SetRules replaces rules at runtime. Counters of rules with the same name are kept
+func (l *Limiter) SetRules(rules []Rule) {
+	l.rules.Store(&rules)
+}
+
+func (l *Limiter) Rules() []Rule {
+	return *l.rules.Load()
+}
+
+// Penalizer return nil if penalties are disabled
+func (l *Limiter) Penalizer() *Penalizer {
+	return l.penalizer
+}
+
+// Now return the time of the limiter clock, overrides expire by it
+func (l *Limiter) Now() time.Time {
+	return l.clock.Now()
+}
+
+type take struct {
+	rule      Rule
+	storeKey  string
+	ttl       time.Duration
+	allowed   bool
+	remaining int64
+	resetAt   time.Time
+	retry     time.Duration
+}
+
+// Check evaluates all matching rules and consumes request cost.
+//
+// Rejected requests don't consume quota.
+func (l *Limiter) Check(ctx context.Context, req Request) (Decision, error) {
+	if req.Cost == 0 {
+		req.Cost = 1
+	}
+
+	d, err := l.check(ctx, &req)
+	if err == nil && l.usage != nil {
+		l.usage.RecordUsage(Usage{
+			Time:    l.clock.Now(),
+			Tenant:  req.Attrs[AttrTenant],
+			Key:     req.Key,
+			Route:   req.Route,
+			Allowed: d.Allowed,
+			Cost:    req.Cost,
+		})
+	}
+
+	return d, err
+}
+
+func (l *Limiter) check(ctx context.Context, req *Request) (Decision, error) {
+	if o := l.override(req.Key, ""); o != nil {
+		switch o.Action {
+		case OverrideExempt:
+			return Decision{Allowed: true}, nil
+		case OverrideBlock:
+			return Decision{Blocked: true, ResetAt: o.ExpiresAt, RetryAfter: o.ExpiresAt.Sub(l.clock.Now())}, nil
+		}
+	}
+
+	if l.penalizer != nil && req.Key != "" {
+		ttl, err := l.penalizer.Banned(ctx, req.Key)
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to check ban: %v", err)
+		}
+
+		if ttl > 0 {
+			return Decision{Banned: true, ResetAt: l.clock.Now().Add(ttl), RetryAfter: ttl}, nil
+		}
+	}
+
+	plan := l.resolvePlan(req)
+
+	d := Decision{Allowed: true}
+	consumed := make([]take, 0)
+	quotaEvents := make([]Event, 0)
+
+	for _, rule := range l.Rules() {
+		if !rule.Match(req.Route) {
+			continue
+		}
+
+		key := req.keyFor(rule)
+		if key == "" {
+			continue
+		}
+
+		var (
+			t       take
+			err     error
+			blocked bool
+		)
+
+		o := l.override(key, rule.Name)
+		rule.Limit = ruleLimit(rule, plan, o)
+
+		switch {
+		case o != nil && o.Action == OverrideExempt:
+			continue
+		case o != nil && o.Action == OverrideBlock:
+			blocked = true
+			t = take{rule: rule, resetAt: o.ExpiresAt, retry: o.ExpiresAt.Sub(l.clock.Now())}
+		default:
+			t, err = l.take(ctx, rule, key, req.Cost, plan)
+			if err != nil {
+				l.refund(ctx, consumed, req.Cost)
+				return Decision{}, fmt.Errorf("rule \"%s\": %v", rule.Name, err)
+			}
+		}
+
+		result := "allowed"
+		if !t.allowed {
+			result = "rejected"
+		}
+
+		if l.metrics != nil {
+			l.metrics.IncrementLimiterDecision(rule.Name, string(rule.Mode), result)
+		}
+
+		if t.allowed {
+			consumed = append(consumed, t)
+		}
+
+		if rule.Mode == ModeShadow {
+			if !t.allowed {
+				d.Shadow = append(d.Shadow, rule.Name)
+				l.infof("shadow rule \"%s\" would reject key \"%s\" on route \"%s\"", rule.Name, key, req.Route)
+			}
+			continue
+		}
+
+		if !d.Allowed {
+			continue
+		}
+
+		if !t.allowed {
+			d.Allowed = false
+			d.Blocked = blocked
+			d.setFrom(t)
+			continue
+		}
+
+		if d.Rule == "" || t.remaining < d.Remaining {
+			d.setFrom(t)
+		}
+
+		if e, ok := quotaEvent(t, key, req.Cost, l.clock.Now()); ok {
+			quotaEvents = append(quotaEvents, e)
+		}
+	}
+
+	if d.Allowed {
+		for _, e := range quotaEvents {
+			l.publish(e, req)
+		}
+
+		return d, nil
+	}
+
+	l.refund(ctx, consumed, req.Cost)
+
+	if !d.Blocked {
+		l.publish(Event{
+			Type:    EventThrottled,
+			Time:    l.clock.Now(),
+			Key:     req.Key,
+			Rule:    d.Rule,
+			Limit:   d.Limit,
+			ResetAt: d.ResetAt,
+		}, req)
+
+		l.penalize(ctx, req)
+	}
+
+	return d, nil
+}
+
+func (l *Limiter) penalize(ctx context.Context, req *Request) {
+	key := req.Key
+	if l.penalizer == nil || key == "" {
+		return
+	}
+
+	d, err := l.penalizer.RecordViolation(ctx, key)
+	if err != nil {
+		l.errorf("failed to record violation of key \"%s\": %v", key, err)
+		return
+	}
+
+	if d > 0 {
+		l.warnf("key \"%s\" is banned for %s", key, d)
+
+		now := l.clock.Now()
+		l.publish(Event{Type: EventBanned, Time: now, Key: key, ResetAt: now.Add(d)}, req)
+	}
+}
+
+// resolvePlan return the plan of the request api key and sets api key and tenant attributes
+func (l *Limiter) resolvePlan(req *Request) *Plan {
+	if req.APIKey == "" {
+		return nil
+	}
+
+	attrs := make(map[string]string, len(req.Attrs)+2)
+	for k, v := range req.Attrs {
+		attrs[k] = v
+	}
+	attrs[AttrAPIKey] = req.APIKey
+	req.Attrs = attrs
+
+	if l.plans == nil {
+		return nil
+	}
+
+	plan, ok := l.plans.ResolvePlan(req.APIKey)
+	if !ok {
+		return nil
+	}
+
+	attrs[AttrTenant] = plan.Tenant
+
+	return &plan
+}
+
+// ruleLimit return the limit of the rule for the key: the override limit, then the plan limit, then the rule default
+func ruleLimit(rule Rule, plan *Plan, o *Override) int64 {
+	if o != nil && o.Action == OverrideLimit {
+		return o.Limit
+	}
+
+	if plan != nil {
+		if limit, ok := plan.Limits[rule.Name]; ok {
+			return limit
+		}
+	}
+
+	return rule.Limit
+}
+
+func (d *Decision) setFrom(t take) {
+	d.Rule = t.rule.Name
+	d.Limit = t.rule.Limit
+	d.Remaining = t.remaining
+	d.ResetAt = t.resetAt
+	d.RetryAfter = t.retry
+}
+
+func (l *Limiter) take(ctx context.Context, rule Rule, key string, cost int64, plan *Plan) (take, error) {
+	switch rule.Algorithm {
+	case AlgorithmSlidingWindow:
+		return l.takeSlidingWindow(ctx, rule, key, cost)
+	default:
+		return l.takeFixedWindow(ctx, rule, key, cost, ruleLocation(rule, plan))
+	}
+}
+
+// ruleLocation return the time zone of calendar windows
+func ruleLocation(rule Rule, plan *Plan) *time.Location {
+	name := rule.TimeZone
+	if plan != nil && plan.TimeZone != "" {
+		name = plan.TimeZone
+	}
+
+	loc, err := loadLocation(name)
+	if err != nil {
+		// rule time zones are validated, tenant time zone may be broken
+		loc, _ = loadLocation(rule.TimeZone)
+	}
+
+	return loc
+}
+
+// takeFixedWindow is used for fixed and calendar windows
+func (l *Limiter) takeFixedWindow(ctx context.Context, rule Rule, key string, cost int64, loc *time.Location) (take, error) {
+	now := l.clock.Now()
+	start, end := rule.bounds(now, loc)
+
+	t := take{
+		rule:     rule,
+		storeKey: counterKey(rule.Name, key, start),
+		ttl:      end.Sub(now),
+		resetAt:  end,
+	}
+
+	n, err := l.store.Incr(ctx, t.storeKey, cost, t.ttl)
+	if err != nil {
+		return t, err
+	}
+
+	if n <= rule.Limit {
+		t.allowed = true
+		t.remaining = rule.Limit - n
+		return t, nil
+	}
+
+	if _, err := l.store.Incr(ctx, t.storeKey, -cost, t.ttl); err != nil {
+		return t, err
+	}
+
+	t.remaining = max(rule.Limit-(n-cost), 0)
+	t.retry = t.resetAt.Sub(now)
+
+	return t, nil
+}
+
+// takeSlidingWindow approximates sliding window by weighting the previous fixed window counter
+func (l *Limiter) takeSlidingWindow(ctx context.Context, rule Rule, key string, cost int64) (take, error) {
+	now := l.clock.Now()
+	window := time.Duration(rule.Window)
+	start, end := rule.bounds(now, time.UTC)
+
+	t := take{
+		rule:     rule,
+		storeKey: counterKey(rule.Name, key, start),
+		ttl:      2 * window,
+		resetAt:  end,
+	}
+
+	prev, err := l.store.Get(ctx, counterKey(rule.Name, key, start.Add(-window)))
+	if err != nil {
+		return t, err
+	}
+
+	// current counter is used as a previous one in the next window
+	n, err := l.store.Incr(ctx, t.storeKey, cost, t.ttl)
+	if err != nil {
+		return t, err
+	}
+
+	weight := 1 - float64(now.Sub(start))/float64(window)
+	estimated := float64(prev)*weight + float64(n)
+
+	if estimated <= float64(rule.Limit) {
+		t.allowed = true
+		t.remaining = rule.Limit - int64(math.Ceil(estimated))
+		return t, nil
+	}
+
+	if _, err := l.store.Incr(ctx, t.storeKey, -cost, t.ttl); err != nil {
+		return t, err
+	}
+
+	t.remaining = max(rule.Limit-int64(math.Ceil(estimated))+cost, 0)
+	t.retry = t.resetAt.Sub(now)
+
+	// previous window share decreases over time, wait until it is small enough
+	if prev > 0 && n <= rule.Limit {
+		perNanosecond := float64(prev) / float64(window)
+		t.retry = min(time.Duration((estimated-float64(rule.Limit))/perNanosecond), t.retry)
+	}
+
+	return t, nil
+}
+
+func (l *Limiter) refund(ctx context.Context, consumed []take, cost int64) {
+	for _, t := range consumed {
+		if _, err := l.store.Incr(ctx, t.storeKey, -cost, t.ttl); err != nil {
+			l.errorf("failed to refund rule \"%s\": %v", t.rule.Name, err)
+		}
+	}
+}
+
+func counterKey(rule, key string, windowStart time.Time) string {
+	return counterPrefix(rule, key) + strconv.FormatInt(windowStart.UnixMilli(), 10)
+}
+
+// counterPrefix is the prefix of counters of the key in all windows of the rule
+func counterPrefix(rule, key string) string {
+	return fmt.Sprintf("rl:%s:%s:", rule, key)
+}
+
+func (l *Limiter) infof(format string, args ...any) {
+	if l.logger != nil {
+		l.logger.Infof(format, args...)
+	}
+}
+
+func (l *Limiter) warnf(format string, args ...any) {
+	if l.logger != nil {
+		l.logger.Warnf(format, args...)
+	}
+}
+
+func (l *Limiter) errorf(format string, args ...any) {
+	if l.logger != nil {
+		l.logger.Errorf(format, args...)
+	}
+}
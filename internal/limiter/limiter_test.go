@@ -0,0 +1,371 @@
+package limiter_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// testLimiter is a limiter with a memory store, both use the fake clock
+type testLimiter struct {
+	*limiter.Limiter
+	store *limiter.MemoryStore
+	clock *clock.Fake
+}
+
+func newTestLimiter(t *testing.T, rules string, opts ...limiter.Option) *testLimiter {
+	t.Helper()
+
+	parsed, err := limiter.ParseRules(rules)
+	require.NoError(t, err)
+
+	c := clock.NewFake(testNow)
+
+	store := limiter.NewMemoryStore(0, limiter.WithStoreClock(c))
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	return &testLimiter{
+		Limiter: limiter.New(nil, store, parsed, append([]limiter.Option{limiter.WithClock(c)}, opts...)...),
+		store:   store,
+		clock:   c,
+	}
+}
+
+// allowed checks req n times and return the number of allowed checks
+func allowed(t *testing.T, l *testLimiter, req limiter.Request, n int) int {
+	t.Helper()
+
+	var res int
+	for i := 0; i < n; i++ {
+		d, err := l.Check(context.Background(), req)
+		require.NoError(t, err)
+		if d.Allowed {
+			res++
+		}
+	}
+
+	return res
+}
+
+// limiterMock resolves plans by api key and records usage and events of the limiter
+type limiterMock struct {
+	plans  map[string]limiter.Plan
+	usage  []limiter.Usage
+	events []limiter.Event
+}
+
+func (m *limiterMock) ResolvePlan(apiKey string) (limiter.Plan, bool) {
+	p, ok := m.plans[apiKey]
+	return p, ok
+}
+
+func (m *limiterMock) ResolveTenantPlan(tenant string) (limiter.Plan, bool) {
+	for _, p := range m.plans {
+		if p.Tenant == tenant {
+			return p, true
+		}
+	}
+	return limiter.Plan{}, false
+}
+
+func (m *limiterMock) RecordUsage(u limiter.Usage) {
+	m.usage = append(m.usage, u)
+}
+
+func (m *limiterMock) PublishEvent(e limiter.Event) {
+	m.events = append(m.events, e)
+}
+
+func TestLimiterModes(t *testing.T) {
+	l := newTestLimiter(t, `[
+		{"name": "enforced", "route": "/req", "limit": 2, "window": "1m"},
+		{"name": "shadowed", "route": "/req", "limit": 1, "window": "1m", "mode": "shadow"},
+		{"name": "disabled", "route": "/req", "limit": 1, "window": "1m", "mode": "off"}
+	]`)
+	req := limiter.Request{Key: "127.0.0.1", Route: "/req"}
+
+	d, err := l.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Empty(t, d.Shadow)
+
+	d, err = l.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed, "shadow rule must not reject")
+	assert.Equal(t, []string{"shadowed"}, d.Shadow)
+
+	d, err = l.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, "enforced", d.Rule)
+
+	t.Run("switch shadow rule to enforce", func(t *testing.T) {
+		rules := append([]limiter.Rule(nil), l.Rules()...)
+		rules[1].Mode = limiter.ModeEnforce
+		l.SetRules(rules)
+
+		req := limiter.Request{Key: "127.0.0.2", Route: "/req"}
+		assert.Equal(t, 1, allowed(t, l, req, 1))
+
+		d, err := l.Check(context.Background(), req)
+		require.NoError(t, err)
+		assert.False(t, d.Allowed)
+		assert.Equal(t, "shadowed", d.Rule)
+		assert.LessOrEqual(t, d.RetryAfter, time.Minute)
+	})
+}
+
+func TestParseRules(t *testing.T) {
+	_, err := limiter.ParseRules(`[{"name": "a", "limit": 1, "window": "1s", "mode": "unknown"}]`)
+	require.Error(t, err)
+
+	_, err = limiter.ParseRules(`[{"name": "a", "limit": 1, "window": "1s"}, {"name": "a", "limit": 1, "window": "1s"}]`)
+	require.Error(t, err)
+}
+
+func TestPenalties(t *testing.T) {
+	bans := limiter.NewMemoryStore(0)
+	defer bans.Close()
+
+	p, err := limiter.NewPenalizer(bans, limiter.PenaltyConfig{
+		Enabled:      true,
+		Violations:   2,
+		Window:       60,
+		BanDurations: []string{"1m", "10m"},
+		Memory:       3600,
+	})
+	require.NoError(t, err)
+
+	l := newTestLimiter(t, `[{"name": "strict", "limit": 1, "window": "1m"}]`, limiter.WithPenalizer(p))
+	req := limiter.Request{Key: "scraper", Route: "/req"}
+
+	check := func() limiter.Decision {
+		d, err := l.Check(context.Background(), req)
+		require.NoError(t, err)
+		return d
+	}
+
+	assert.True(t, check().Allowed)
+	assert.False(t, check().Banned)
+	assert.False(t, check().Banned, "the request reaching violations limit is still rejected with 429")
+
+	d := check()
+	assert.True(t, d.Banned)
+	assert.LessOrEqual(t, d.RetryAfter, time.Minute)
+
+	list, err := p.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "scraper", list[0].Key)
+	assert.Equal(t, int64(1), list[0].Level)
+
+	t.Run("escalate ban duration", func(t *testing.T) {
+		// the ban expires together with its violations
+		require.NoError(t, bans.Delete(context.Background(), "pn:ban:scraper", "pn:viol:scraper"))
+
+		check()
+		d := check()
+		assert.False(t, d.Allowed)
+
+		d = check()
+		assert.True(t, d.Banned)
+		assert.Greater(t, d.RetryAfter, time.Minute)
+	})
+
+	t.Run("lift ban", func(t *testing.T) {
+		require.NoError(t, p.Lift(context.Background(), "scraper"))
+
+		list, err := p.List(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, list)
+		assert.False(t, check().Banned)
+	})
+
+	t.Run("concurrent violations raise one level", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := p.RecordViolation(context.Background(), "burst")
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		list, err := p.List(context.Background())
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "burst", list[0].Key)
+		assert.Equal(t, int64(1), list[0].Level)
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	l := newTestLimiter(t, `[{"name": "strict", "limit": 1, "window": "1m"}]`)
+	expiresAt := testNow.Add(time.Hour)
+
+	l.SetOverrides([]limiter.Override{
+		{Key: "partner", Rule: "strict", Action: limiter.OverrideLimit, Limit: 3, ExpiresAt: expiresAt},
+		{Key: "internal", Action: limiter.OverrideExempt, ExpiresAt: expiresAt},
+		{Key: "abuser", Action: limiter.OverrideBlock, ExpiresAt: expiresAt},
+		{Key: "expired", Action: limiter.OverrideExempt, ExpiresAt: testNow.Add(-time.Second)},
+	})
+
+	tt := []struct {
+		key     string
+		allowed int
+	}{
+		{key: "partner", allowed: 3},
+		{key: "internal", allowed: 5},
+		{key: "abuser", allowed: 0},
+		{key: "expired", allowed: 1},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.allowed, allowed(t, l, limiter.Request{Key: tc.key}, 5), tc.key)
+	}
+
+	state, err := l.Inspect(context.Background(), "partner")
+	require.NoError(t, err)
+	require.Len(t, state.Rules, 1)
+	assert.Equal(t, int64(3), state.Rules[0].Used)
+	assert.Equal(t, int64(0), state.Rules[0].Remaining)
+
+	require.NoError(t, l.Reset(context.Background(), "partner"))
+	assert.Equal(t, 3, allowed(t, l, limiter.Request{Key: "partner"}, 5))
+
+	t.Run("reset keeps keys with the same prefix", func(t *testing.T) {
+		assert.Equal(t, 1, allowed(t, l, limiter.Request{Key: "::1"}, 2))
+		assert.Equal(t, 1, allowed(t, l, limiter.Request{Key: "::1:5"}, 2))
+
+		require.NoError(t, l.Reset(context.Background(), "::1"))
+		assert.Equal(t, 1, allowed(t, l, limiter.Request{Key: "::1"}, 1))
+		assert.Equal(t, 0, allowed(t, l, limiter.Request{Key: "::1:5"}, 1))
+	})
+}
+
+func TestPlans(t *testing.T) {
+	pro := limiter.Plan{Tenant: "1", Name: "pro", Limits: map[string]int64{"per-tenant": 3}}
+	l := newTestLimiter(t, `[{"name": "per-tenant", "key_by": "tenant", "limit": 1, "window": "1m"}]`,
+		limiter.WithPlans(&limiterMock{plans: map[string]limiter.Plan{"key-1": pro, "key-2": pro}}),
+	)
+
+	// cases share the limiter and run in order
+	tt := []struct {
+		name    string
+		apiKey  string
+		allowed int
+	}{
+		{name: "plan limit replaces the rule limit", apiKey: "key-1", allowed: 2},
+		{name: "keys of the same tenant share the quota", apiKey: "key-2", allowed: 1},
+		{name: "rule is skipped without tenant", apiKey: "unknown", allowed: 2},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.allowed, allowed(t, l, limiter.Request{Key: "127.0.0.1", APIKey: tc.apiKey}, 2), tc.name)
+	}
+
+	t.Run("inspect reports the plan limit", func(t *testing.T) {
+		state, err := l.Inspect(context.Background(), "1")
+		require.NoError(t, err)
+		require.Len(t, state.Rules, 1)
+		assert.Equal(t, int64(3), state.Rules[0].Limit)
+		assert.Equal(t, int64(3), state.Rules[0].Used)
+		assert.Equal(t, int64(0), state.Rules[0].Remaining)
+
+		l.SetOverrides([]limiter.Override{
+			{Key: "1", Rule: "per-tenant", Action: limiter.OverrideLimit, Limit: 5, ExpiresAt: testNow.Add(time.Hour)},
+		})
+
+		state, err = l.Inspect(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), state.Rules[0].Limit, "the override has priority over the plan")
+		assert.Equal(t, int64(2), state.Rules[0].Remaining)
+	})
+}
+
+func TestTenantTimeZone(t *testing.T) {
+	// the tenant day starts at 04:00 utc, the rule day at 15:00 utc
+	plan := limiter.Plan{Tenant: "1", Name: "pro", TimeZone: "America/New_York"}
+	l := newTestLimiter(t, `[{"name": "daily", "key_by": "tenant", "limit": 1, "algorithm": "calendar_day", "time_zone": "Asia/Tokyo"}]`,
+		limiter.WithPlans(&limiterMock{plans: map[string]limiter.Plan{"key-1": plan}}),
+	)
+	req := limiter.Request{Key: "127.0.0.1", APIKey: "key-1"}
+	midnight := time.Date(2024, 5, 2, 4, 0, 0, 0, time.UTC)
+
+	l.clock.Set(midnight.Add(-time.Minute))
+
+	d, err := l.Check(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, midnight, d.ResetAt.UTC(), "tenant time zone overrides the rule time zone")
+	assert.Equal(t, 0, allowed(t, l, req, 1))
+
+	state, err := l.Inspect(context.Background(), "1")
+	require.NoError(t, err)
+	require.Len(t, state.Rules, 1)
+	assert.Equal(t, int64(1), state.Rules[0].Used)
+	assert.Equal(t, midnight, state.Rules[0].ResetAt.UTC())
+
+	t.Run("reset counter of the tenant day", func(t *testing.T) {
+		require.NoError(t, l.Reset(context.Background(), "1"))
+
+		state, err := l.Inspect(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), state.Rules[0].Used)
+		assert.Equal(t, 1, allowed(t, l, req, 2))
+	})
+
+	t.Run("next tenant day", func(t *testing.T) {
+		l.clock.Set(midnight)
+		assert.Equal(t, 1, allowed(t, l, req, 2))
+	})
+}
+
+func TestUsage(t *testing.T) {
+	m := &limiterMock{plans: map[string]limiter.Plan{"key-1": {Tenant: "1", Name: "pro"}}}
+	l := newTestLimiter(t, `[{"name": "strict", "limit": 2, "window": "1m"}]`, limiter.WithUsage(m), limiter.WithPlans(m))
+
+	allowed(t, l, limiter.Request{Key: "127.0.0.1", APIKey: "key-1", Route: "/req", Cost: 2}, 2)
+
+	require.Len(t, m.usage, 2)
+	assert.Equal(t, "1", m.usage[0].Tenant)
+	assert.Equal(t, "/req", m.usage[0].Route)
+	assert.Equal(t, int64(2), m.usage[0].Cost)
+	assert.Equal(t, testNow, m.usage[0].Time)
+	assert.True(t, m.usage[0].Allowed)
+	assert.False(t, m.usage[1].Allowed)
+}
+
+func TestEvents(t *testing.T) {
+	m := &limiterMock{}
+	l := newTestLimiter(t, `[{"name": "daily", "limit": 10, "algorithm": "calendar_day"}]`, limiter.WithEvents(m))
+	req := limiter.Request{Key: "client", Cost: 2}
+
+	types := func() []limiter.EventType {
+		res := make([]limiter.EventType, 0)
+		for _, e := range m.events {
+			res = append(res, e.Type)
+		}
+		return res
+	}
+
+	allowed(t, l, req, 4)
+	assert.Equal(t, []limiter.EventType{limiter.EventQuotaWarning}, types())
+
+	allowed(t, l, req, 2)
+	assert.Equal(t, []limiter.EventType{limiter.EventQuotaWarning, limiter.EventQuotaExhausted, limiter.EventThrottled}, types())
+	assert.Equal(t, int64(10), m.events[1].Used)
+}
@@ -0,0 +1,51 @@
+package limiter
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(*Options)
+
+type Options struct {
+	Metrics   Metrics
+	Penalizer *Penalizer
+	Plans     PlanResolver
+	Usage     UsageRecorder
+	Events    EventPublisher
+	// Clock - default clock.Real
+	Clock clock.Clock
+}
+
+func WithMetrics(v Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = v
+	}
+}
+
+func WithPenalizer(v *Penalizer) Option {
+	return func(o *Options) {
+		o.Penalizer = v
+	}
+}
+
+func WithPlans(v PlanResolver) Option {
+	return func(o *Options) {
+		o.Plans = v
+	}
+}
+
+func WithUsage(v UsageRecorder) Option {
+	return func(o *Options) {
+		o.Usage = v
+	}
+}
+
+func WithEvents(v EventPublisher) Option {
+	return func(o *Options) {
+		o.Events = v
+	}
+}
+
+func WithClock(v clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = v
+	}
+}
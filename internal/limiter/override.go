@@ -0,0 +1,249 @@
+package limiter
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type OverrideAction string
+
+const (
+	// OverrideLimit replaces the limit of the rule for the key
+	OverrideLimit OverrideAction = "limit"
+	// OverrideExempt skips the rule for the key
+	OverrideExempt OverrideAction = "exempt"
+	// OverrideBlock rejects all requests of the key with 403
+	OverrideBlock OverrideAction = "block"
+)
+
+// Override is a temporary per key exception from the rules
+type Override struct {
+	Key string `json:"key"`
+	// Rule name. Empty rule means all rules
+	Rule      string         `json:"rule"`
+	Action    OverrideAction `json:"action"`
+	Limit     int64          `json:"limit,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Validate checks fields of the override, use ValidateAt to check it is not expired
+func (o *Override) Validate() error {
+	return validation.ValidateStruct(
+		o,
+		validation.Field(&o.Key, validation.Required),
+		validation.Field(&o.Action, validation.Required, validation.In(OverrideLimit, OverrideExempt, OverrideBlock)),
+		validation.Field(&o.Limit, validation.When(o.Action == OverrideLimit, validation.Required, validation.Min(int64(1)))),
+		validation.Field(&o.ExpiresAt, validation.Required),
+	)
+}
+
+// ValidateAt checks fields of the override and that it expires after now
+func (o *Override) ValidateAt(now time.Time) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	return validation.ValidateStruct(o, validation.Field(&o.ExpiresAt, validation.Min(now)))
+}
+
+func (o *Override) active(now time.Time) bool {
+	return now.Before(o.ExpiresAt)
+}
+
+// SetOverrides replaces all overrides
+func (l *Limiter) SetOverrides(overrides []Override) {
+	m := make(map[string][]Override, len(overrides))
+	for _, o := range overrides {
+		m[o.Key] = append(m[o.Key], o)
+	}
+
+	l.overrides.Store(&m)
+}
+
+// Overrides return active overrides of the key
+func (l *Limiter) Overrides(key string) []Override {
+	m := l.overrides.Load()
+	if m == nil {
+		return nil
+	}
+
+	now := l.clock.Now()
+
+	res := make([]Override, 0)
+	for _, o := range (*m)[key] {
+		if o.active(now) {
+			res = append(res, o)
+		}
+	}
+
+	return res
+}
+
+// override return the override of the rule for the key, rule specific overrides have priority
+func (l *Limiter) override(key, rule string) *Override {
+	var res *Override
+	for _, o := range l.Overrides(key) {
+		if o.Rule == rule {
+			return &o
+		}
+
+		if o.Rule == "" {
+			res = &o
+		}
+	}
+
+	return res
+}
+
+type RuleState struct {
+	Rule      string    `json:"rule"`
+	Mode      Mode      `json:"mode"`
+	Algorithm Algorithm `json:"algorithm"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+	Override  *Override `json:"override,omitempty"`
+}
+
+type KeyState struct {
+	Key       string      `json:"key"`
+	Rules     []RuleState `json:"rules"`
+	Overrides []Override  `json:"overrides"`
+	// Ban is set if the key is banned right now
+	Ban *Ban `json:"ban,omitempty"`
+}
+
+// Inspect return the state of the key in all rules without consuming quota
+func (l *Limiter) Inspect(ctx context.Context, key string) (KeyState, error) {
+	res := KeyState{
+		Key:       key,
+		Rules:     make([]RuleState, 0),
+		Overrides: l.Overrides(key),
+	}
+
+	for _, rule := range l.Rules() {
+		st := RuleState{
+			Rule:      rule.Name,
+			Mode:      rule.Mode,
+			Algorithm: rule.Algorithm,
+			Override:  l.override(key, rule.Name),
+		}
+
+		plan := l.planOfKey(rule, key)
+		rule.Limit = ruleLimit(rule, plan, st.Override)
+
+		used, resetAt, err := l.peek(ctx, rule, key, plan)
+		if err != nil {
+			return res, err
+		}
+
+		st.Limit = rule.Limit
+		st.Used = used
+		st.Remaining = max(rule.Limit-used, 0)
+		st.ResetAt = resetAt
+
+		res.Rules = append(res.Rules, st)
+	}
+
+	if l.penalizer != nil {
+		ttl, err := l.penalizer.Banned(ctx, key)
+		if err != nil {
+			return res, err
+		}
+
+		if ttl > 0 {
+			res.Ban = &Ban{Key: key, ExpiresAt: l.clock.Now().Add(ttl)}
+		}
+	}
+
+	return res, nil
+}
+
+// Reset removes counters of the key in all rules and lifts its ban.
+// Counters are found by prefix, so windows in any time zone (e.g. of the tenant plan) are removed
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	keys := make([]string, 0)
+	for _, rule := range l.Rules() {
+		prefix := counterPrefix(rule.Name, key)
+
+		found, err := l.store.Keys(ctx, prefix)
+		if err != nil {
+			return err
+		}
+
+		// keys with ':' may share the prefix with other keys, e.g. ipv6 addresses
+		for _, k := range found {
+			if _, err := strconv.ParseInt(k[len(prefix):], 10, 64); err == nil {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	if err := l.store.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	if l.penalizer != nil {
+		return l.penalizer.Lift(ctx, key)
+	}
+
+	return nil
+}
+
+// peek return used quota of the rule without consuming it
+func (l *Limiter) peek(ctx context.Context, rule Rule, key string, plan *Plan) (int64, time.Time, error) {
+	now := l.clock.Now()
+	window := time.Duration(rule.Window)
+	start, end := rule.bounds(now, ruleLocation(rule, plan))
+
+	n, err := l.store.Get(ctx, counterKey(rule.Name, key, start))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if rule.Algorithm != AlgorithmSlidingWindow {
+		return n, end, nil
+	}
+
+	prev, err := l.store.Get(ctx, counterKey(rule.Name, key, start.Add(-window)))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	weight := 1 - float64(now.Sub(start))/float64(window)
+
+	return int64(float64(prev)*weight) + n, end, nil
+}
+
+// planOfKey return the plan of keys of rules keyed by api key or tenant, like Check resolves it for the request
+func (l *Limiter) planOfKey(rule Rule, key string) *Plan {
+	if l.plans == nil {
+		return nil
+	}
+
+	var (
+		plan Plan
+		ok   bool
+	)
+
+	switch rule.KeyBy {
+	case AttrAPIKey:
+		plan, ok = l.plans.ResolvePlan(key)
+	case AttrTenant:
+		if r, isTenantResolver := l.plans.(TenantPlanResolver); isTenantResolver {
+			plan, ok = r.ResolveTenantPlan(key)
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	return &plan
+}
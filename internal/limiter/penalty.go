@@ -0,0 +1,224 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	violationsPrefix = "pn:viol:"
+	levelPrefix      = "pn:level:"
+	banPrefix        = "pn:ban:"
+)
+
+type PenaltyConfig struct {
+	Enabled bool `json:"RATE_LIMIT_PENALTY_ENABLED"`
+	// Rejected requests within the window which lead to a ban. Default 10
+	Violations int64 `json:"RATE_LIMIT_PENALTY_VIOLATIONS" default:"10"`
+	// In seconds. Default 60 seconds
+	Window int `json:"RATE_LIMIT_PENALTY_WINDOW" default:"60"`
+	// Escalating ban durations. Default 1m,10m,1h
+	BanDurations []string `json:"RATE_LIMIT_PENALTY_BAN_DURATIONS" default:"1m,10m,1h"`
+	// How long previous bans are remembered for escalation. In seconds. Default 24 hours
+	Memory int `json:"RATE_LIMIT_PENALTY_MEMORY" default:"86400"`
+}
+
+func (c *PenaltyConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if err := validation.ValidateStruct(
+		c,
+		validation.Field(&c.Violations, validation.Required, validation.Min(int64(1))),
+		validation.Field(&c.Window, validation.Required, validation.Min(1)),
+		validation.Field(&c.BanDurations, validation.Required),
+		validation.Field(&c.Memory, validation.Required, validation.Min(1)),
+	); err != nil {
+		return err
+	}
+
+	_, err := c.getBanDurations()
+	return err
+}
+
+func (c *PenaltyConfig) getBanDurations() ([]time.Duration, error) {
+	res := make([]time.Duration, 0, len(c.BanDurations))
+	for _, v := range c.BanDurations {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("bad ban duration \"%s\": %v", v, err)
+		}
+
+		if d <= 0 {
+			return nil, fmt.Errorf("ban duration \"%s\" must be positive", v)
+		}
+
+		res = append(res, d)
+	}
+
+	return res, nil
+}
+
+type Ban struct {
+	Key string `json:"key"`
+	// Level - how many times the key was banned recently
+	Level     int64     `json:"level"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Penalizer bans keys which exceed limits too often.
+//
+// Each next ban within the memory period lasts longer. State is kept in the limiter store, so bans are shared by all instances.
+type Penalizer struct {
+	store Store
+	clock clock.Clock
+
+	violations int64
+	window     time.Duration
+	durations  []time.Duration
+	memory     time.Duration
+}
+
+type PenalizerOption func(p *Penalizer)
+
+// WithPenalizerClock - clock of ban expiration times. Default clock.Real
+func WithPenalizerClock(c clock.Clock) PenalizerOption {
+	return func(p *Penalizer) {
+		p.clock = c
+	}
+}
+
+func NewPenalizer(store Store, cfg PenaltyConfig, opts ...PenalizerOption) (*Penalizer, error) {
+	durations, err := cfg.getBanDurations()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(durations) == 0 {
+		return nil, fmt.Errorf("empty ban durations")
+	}
+
+	p := &Penalizer{
+		store:      store,
+		clock:      clock.Real{},
+		violations: cfg.Violations,
+		window:     time.Duration(cfg.Window) * time.Second,
+		durations:  durations,
+		memory:     time.Duration(cfg.Memory) * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+// Banned return time left until the ban of the key expires, 0 if the key is not banned
+func (p *Penalizer) Banned(ctx context.Context, key string) (time.Duration, error) {
+	level, err := p.store.Get(ctx, banPrefix+key)
+	if err != nil || level == 0 {
+		return 0, err
+	}
+
+	return p.store.TTL(ctx, banPrefix+key)
+}
+
+// RecordViolation counts rejected request and bans the key when violations limit is reached.
+//
+// Return ban duration if the key was banned.
+func (p *Penalizer) RecordViolation(ctx context.Context, key string) (time.Duration, error) {
+	n, err := p.store.Incr(ctx, violationsPrefix+key, 1, p.window)
+	if err != nil {
+		return 0, err
+	}
+
+	// only the violation reaching the limit bans the key, concurrent violations above it must not raise the level again
+	if n != p.violations {
+		return 0, nil
+	}
+
+	level, err := p.store.Incr(ctx, levelPrefix+key, 1, p.memory)
+	if err != nil {
+		return 0, err
+	}
+
+	d := p.durations[min(int(level), len(p.durations))-1]
+	if err := p.store.Set(ctx, banPrefix+key, level, d); err != nil {
+		return 0, err
+	}
+
+	// violations are counted again after the ban, the counter stays above the limit until then
+	if err := p.store.Set(ctx, violationsPrefix+key, p.violations, d); err != nil {
+		return 0, err
+	}
+
+	return d, nil
+}
+
+// Ban bans the key for d manually, the ban level is not changed
+func (p *Penalizer) Ban(ctx context.Context, key string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("ban duration must be positive")
+	}
+
+	level, err := p.store.Get(ctx, levelPrefix+key)
+	if err != nil {
+		return err
+	}
+
+	return p.store.Set(ctx, banPrefix+key, max(level, 1), d)
+}
+
+// List return active bans sorted by key
+func (p *Penalizer) List(ctx context.Context) ([]Ban, error) {
+	keys, err := p.store.Keys(ctx, banPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.clock.Now()
+
+	res := make([]Ban, 0, len(keys))
+	for _, storeKey := range keys {
+		level, err := p.store.Get(ctx, storeKey)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl, err := p.store.TTL(ctx, storeKey)
+		if err != nil {
+			return nil, err
+		}
+
+		// expired between listing and reading
+		if level == 0 || ttl == 0 {
+			continue
+		}
+
+		res = append(res, Ban{
+			Key:       strings.TrimPrefix(storeKey, banPrefix),
+			Level:     level,
+			ExpiresAt: now.Add(ttl),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+
+	return res, nil
+}
+
+// Lift removes the ban and forgets previous violations of the key
+func (p *Penalizer) Lift(ctx context.Context, key string) error {
+	return p.store.Delete(ctx, banPrefix+key, levelPrefix+key, violationsPrefix+key)
+}
@@ -0,0 +1,206 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// incrQuery increments the counter, expired counters start from 0 with the new ttl
+const incrQuery = `
+INSERT INTO limiter_counters (key, value, expires_at) VALUES ($1, $2, $3::timestamptz)
+ON CONFLICT (key) DO UPDATE SET
+	value = CASE WHEN limiter_counters.expires_at <= $4::timestamptz
+		THEN EXCLUDED.value ELSE limiter_counters.value + EXCLUDED.value END,
+	expires_at = CASE WHEN limiter_counters.expires_at <= $4::timestamptz
+		THEN EXCLUDED.expires_at ELSE limiter_counters.expires_at END
+RETURNING value`
+
+// PostgresStore is a Store shared by all instances, counters are kept in the limiter_counters table.
+// Expiration is checked with the store clock, so clocks of instances should be in sync
+type PostgresStore struct {
+	// db is replaced on reconnect to postgres
+	db     atomic.Pointer[postgres.PostgreSQL]
+	prefix string
+
+	clock clock.Clock
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type PostgresStoreOption func(s *PostgresStore)
+
+// WithPostgresStoreClock - clock of counters expiration and the janitor. Default clock.Real
+func WithPostgresStoreClock(c clock.Clock) PostgresStoreOption {
+	return func(s *PostgresStore) {
+		s.clock = c
+	}
+}
+
+// NewPostgresStore return postgres store with a janitor deleting expired counters every cleanupInterval.
+// All keys are prefixed with prefix, e.g. service name
+//
+// Default cleanupInterval: 1 minute
+func NewPostgresStore(db *postgres.PostgreSQL, prefix string, cleanupInterval time.Duration, opts ...PostgresStoreOption) *PostgresStore {
+	if cleanupInterval == 0 {
+		cleanupInterval = time.Minute
+	}
+
+	if prefix != "" {
+		prefix += ":"
+	}
+
+	s := &PostgresStore{
+		prefix: prefix,
+		clock:  clock.Real{},
+		stop:   make(chan struct{}),
+	}
+	s.SetDB(db)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.janitor(s.clock.NewTicker(cleanupInterval))
+
+	return s
+}
+
+// SetDB replaces the postgres connection of the store, e.g. after reconnect
+func (s *PostgresStore) SetDB(db *postgres.PostgreSQL) {
+	s.db.Store(db)
+}
+
+func (s *PostgresStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	now := s.clock.Now()
+
+	var v int64
+	err := s.db.Load().QueryRow(ctx, incrQuery, s.prefix+key, delta, expiresAt(now, ttl), now).Scan(&v)
+
+	return v, err
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (int64, error) {
+	var v int64
+	err := s.db.Load().QueryRow(ctx,
+		`SELECT value FROM limiter_counters WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2)`,
+		s.prefix+key, s.clock.Now(),
+	).Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return v, err
+}
+
+func (s *PostgresStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	_, err := s.db.Load().Exec(ctx, `
+		INSERT INTO limiter_counters (key, value, expires_at) VALUES ($1, $2, $3::timestamptz)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		s.prefix+key, value, expiresAt(s.clock.Now(), ttl),
+	)
+
+	return err
+}
+
+func (s *PostgresStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	now := s.clock.Now()
+
+	var expires *time.Time
+	err := s.db.Load().QueryRow(ctx,
+		`SELECT expires_at FROM limiter_counters WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2)`,
+		s.prefix+key, now,
+	).Scan(&expires)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && expires == nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return expires.Sub(now), nil
+}
+
+// likeEscaper escapes special characters of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s *PostgresStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	rows, err := s.db.Load().Query(ctx,
+		`SELECT key FROM limiter_counters WHERE key LIKE $1 AND (expires_at IS NULL OR expires_at > $2)`,
+		likeEscaper.Replace(s.prefix+prefix)+"%", s.clock.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key[len(s.prefix):])
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, s.prefix+key)
+	}
+
+	_, err := s.db.Load().Exec(ctx, `DELETE FROM limiter_counters WHERE key = ANY($1)`, prefixed)
+
+	return err
+}
+
+// Close stops the janitor, postgres connection is owned by the caller
+func (s *PostgresStore) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+
+	return nil
+}
+
+func (s *PostgresStore) janitor(ticker clock.Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			// errors are ignored, expired counters are not visible and are deleted on the next tick
+			_, _ = s.db.Load().Exec(context.Background(), `DELETE FROM limiter_counters WHERE expires_at <= $1`, s.clock.Now())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// expiresAt return expiration time of a counter with ttl, nil if the counter never expires
+func expiresAt(now time.Time, ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+
+	t := now.Add(ttl)
+
+	return &t
+}
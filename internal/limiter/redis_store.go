@@ -0,0 +1,122 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrScript increments the counter and sets ttl if the counter has no expiration yet
+var incrScript = redis.NewScript(`
+local v = redis.call("INCRBY", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return v
+`)
+
+// RedisStore is a Store shared by all instances
+type RedisStore struct {
+	mu sync.RWMutex
+	// client is replaced on reconnect, use conn to read it
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore return redis store. All keys are prefixed with prefix, e.g. service name
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix != "" {
+		prefix += ":"
+	}
+
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// SetClient replaces the redis client, e.g. after reconnect. The previous client is not closed
+func (s *RedisStore) SetClient(client redis.UniversalClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+}
+
+func (s *RedisStore) conn() redis.UniversalClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.client
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.conn(), []string{s.prefix + key}, delta, ttl.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	v, err := s.conn().Get(ctx, s.prefix+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+
+	return v, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	return s.conn().Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.conn().PTTL(ctx, s.prefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// -1 and -2 are returned for keys without expiration and missing keys
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// globEscaper escapes special characters of SCAN patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (s *RedisStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+
+	iter := s.conn().Scan(ctx, 0, globEscaper.Replace(s.prefix+prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val()[len(s.prefix):])
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, s.prefix+key)
+	}
+
+	return s.conn().Del(ctx, prefixed...).Err()
+}
+
+// Close does nothing, redis client is owned by the caller
+func (s *RedisStore) Close() error {
+	return nil
+}
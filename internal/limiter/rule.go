@@ -0,0 +1,187 @@
+package limiter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/goccy/go-json"
+)
+
+type Mode string
+
+const (
+	// ModeEnforce rejects requests over the limit
+	ModeEnforce Mode = "enforce"
+	// ModeShadow evaluates the rule and records the decision, but always allows the request
+	ModeShadow Mode = "shadow"
+	// ModeOff disables the rule
+	ModeOff Mode = "off"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmFixedWindow   Algorithm = "fixed_window"
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+	// AlgorithmCalendarDay resets the quota at midnight in the rule (or tenant) time zone
+	AlgorithmCalendarDay Algorithm = "calendar_day"
+	// AlgorithmCalendarMonth resets the quota at midnight of the first day of month in the rule (or tenant) time zone
+	AlgorithmCalendarMonth Algorithm = "calendar_month"
+)
+
+// Duration is time.Duration which is encoded in json as a string, e.g. "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1m\": %v", err)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+type Rule struct {
+	Name string `json:"name"`
+	// Route is a path prefix the rule applies to. Empty route matches all requests
+	Route string `json:"route"`
+	// KeyBy is a request attribute used as a rate limit key. Empty value means the caller key (client ip by default)
+	KeyBy string `json:"key_by"`
+	// Algorithm - default fixed_window
+	Algorithm Algorithm `json:"algorithm"`
+	// Limit - amount of cost units allowed in the window
+	Limit int64 `json:"limit"`
+	// Window is not used by calendar algorithms
+	Window Duration `json:"window"`
+	// TimeZone - IANA time zone of calendar windows, tenant time zone has priority. Default UTC
+	TimeZone string `json:"time_zone"`
+	// Mode - default enforce
+	Mode Mode `json:"mode"`
+}
+
+func (r *Rule) Validate() error {
+	return validation.ValidateStruct(
+		r,
+		validation.Field(&r.Name, validation.Required),
+		validation.Field(&r.Algorithm, validation.In(AlgorithmFixedWindow, AlgorithmSlidingWindow, AlgorithmCalendarDay, AlgorithmCalendarMonth)),
+		validation.Field(&r.Limit, validation.Required, validation.Min(int64(1))),
+		validation.Field(&r.Window, validation.When(!r.isCalendar(), validation.Required, validation.Min(Duration(time.Millisecond)))),
+		validation.Field(&r.TimeZone, validation.By(func(any) error {
+			_, err := loadLocation(r.TimeZone)
+			return err
+		})),
+		validation.Field(&r.Mode, validation.In(ModeEnforce, ModeShadow, ModeOff)),
+	)
+}
+
+func (r *Rule) isCalendar() bool {
+	return r.Algorithm == AlgorithmCalendarDay || r.Algorithm == AlgorithmCalendarMonth
+}
+
+// bounds return start and end of the window containing now.
+//
+// Calendar windows are aligned to midnight in loc, so days are 23 or 25 hours long on DST changes.
+func (r *Rule) bounds(now time.Time, loc *time.Location) (time.Time, time.Time) {
+	switch r.Algorithm {
+	case AlgorithmCalendarDay:
+		local := now.In(loc)
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	case AlgorithmCalendarMonth:
+		local := now.In(loc)
+		start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		window := time.Duration(r.Window)
+		start := now.Truncate(window)
+		return start, start.Add(window)
+	}
+}
+
+var locations sync.Map
+
+// loadLocation return cached location, empty name is UTC
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.Store(name, loc)
+
+	return loc, nil
+}
+
+// Match check that the rule applies to the route
+func (r *Rule) Match(route string) bool {
+	return r.Mode != ModeOff && strings.HasPrefix(route, r.Route)
+}
+
+// ParseRules parse json list of rules and set default values
+func ParseRules(data string) ([]Rule, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rules: %v", err)
+	}
+
+	names := make(map[string]struct{}, len(rules))
+	for i := range rules {
+		if rules[i].Algorithm == "" {
+			rules[i].Algorithm = AlgorithmFixedWindow
+		}
+
+		if rules[i].Mode == "" {
+			rules[i].Mode = ModeEnforce
+		}
+
+		if err := rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("rule #%d \"%s\": %v", i, rules[i].Name, err)
+		}
+
+		if _, ok := names[rules[i].Name]; ok {
+			return nil, fmt.Errorf("rule #%d: duplicated name \"%s\"", i, rules[i].Name)
+		}
+		names[rules[i].Name] = struct{}{}
+	}
+
+	return rules, nil
+}
+
+// DefaultRules is used when rules are not configured: one request per second per client
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:      "default",
+			Algorithm: AlgorithmFixedWindow,
+			Limit:     1,
+			Window:    Duration(time.Second),
+			Mode:      ModeEnforce,
+		},
+	}
+}
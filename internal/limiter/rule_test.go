@@ -0,0 +1,83 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarBounds(t *testing.T) {
+	ny, err := loadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tt := []struct {
+		name      string
+		algorithm Algorithm
+		now       time.Time
+		start     time.Time
+		end       time.Time
+		length    time.Duration
+	}{
+		{
+			name:      "day",
+			algorithm: AlgorithmCalendarDay,
+			now:       time.Date(2024, 6, 10, 23, 30, 0, 0, ny),
+			start:     time.Date(2024, 6, 10, 0, 0, 0, 0, ny),
+			end:       time.Date(2024, 6, 11, 0, 0, 0, 0, ny),
+			length:    24 * time.Hour,
+		},
+		{
+			name:      "day in tenant zone differs from utc day",
+			algorithm: AlgorithmCalendarDay,
+			now:       time.Date(2024, 6, 11, 2, 0, 0, 0, time.UTC),
+			start:     time.Date(2024, 6, 10, 0, 0, 0, 0, ny),
+			end:       time.Date(2024, 6, 11, 0, 0, 0, 0, ny),
+			length:    24 * time.Hour,
+		},
+		{
+			name:      "spring forward day is 23 hours",
+			algorithm: AlgorithmCalendarDay,
+			now:       time.Date(2024, 3, 10, 12, 0, 0, 0, ny),
+			start:     time.Date(2024, 3, 10, 0, 0, 0, 0, ny),
+			end:       time.Date(2024, 3, 11, 0, 0, 0, 0, ny),
+			length:    23 * time.Hour,
+		},
+		{
+			name:      "fall back day is 25 hours",
+			algorithm: AlgorithmCalendarDay,
+			now:       time.Date(2024, 11, 3, 1, 30, 0, 0, ny),
+			start:     time.Date(2024, 11, 3, 0, 0, 0, 0, ny),
+			end:       time.Date(2024, 11, 4, 0, 0, 0, 0, ny),
+			length:    25 * time.Hour,
+		},
+		{
+			name:      "month with dst change",
+			algorithm: AlgorithmCalendarMonth,
+			now:       time.Date(2024, 3, 31, 23, 59, 59, 0, ny),
+			start:     time.Date(2024, 3, 1, 0, 0, 0, 0, ny),
+			end:       time.Date(2024, 4, 1, 0, 0, 0, 0, ny),
+			length:    31*24*time.Hour - time.Hour,
+		},
+		{
+			name:      "end of month is the start of the next one",
+			algorithm: AlgorithmCalendarMonth,
+			now:       time.Date(2024, 4, 1, 0, 0, 0, 0, ny),
+			start:     time.Date(2024, 4, 1, 0, 0, 0, 0, ny),
+			end:       time.Date(2024, 5, 1, 0, 0, 0, 0, ny),
+			length:    30 * 24 * time.Hour,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Rule{Algorithm: tc.algorithm}
+
+			start, end := r.bounds(tc.now, ny)
+			assert.True(t, tc.start.Equal(start), "start %s, expected %s", start, tc.start)
+			assert.True(t, tc.end.Equal(end), "end %s, expected %s", end, tc.end)
+			assert.Equal(t, tc.length, end.Sub(start))
+		})
+	}
+}
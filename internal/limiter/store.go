@@ -0,0 +1,196 @@
+package limiter
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+)
+
+// Store keeps limiter counters. Implementations must be safe for concurrent use
+// and Incr must be atomic across all instances sharing the store.
+type Store interface {
+	// Incr adds delta to the counter and return the new value.
+	// ttl is applied only when the counter is created, ttl == 0 means the counter never expires.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get return counter value, missing counter is 0
+	Get(ctx context.Context, key string) (int64, error)
+	// Set replaces the counter value and its ttl
+	Set(ctx context.Context, key string, value int64, ttl time.Duration) error
+	// TTL return time left until the counter expires, 0 for missing counters and counters without expiration
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Keys return all existing keys with the prefix
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+type memoryEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+// MemoryStore is a Store for a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+
+	clock clock.Clock
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type MemoryStoreOption func(s *MemoryStore)
+
+// WithStoreClock - clock of counters expiration and the janitor. Default clock.Real
+func WithStoreClock(c clock.Clock) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.clock = c
+	}
+}
+
+// NewMemoryStore return in-memory store with a janitor removing expired counters every cleanupInterval
+//
+// Default cleanupInterval: 1 minute
+func NewMemoryStore(cleanupInterval time.Duration, opts ...MemoryStoreOption) *MemoryStore {
+	if cleanupInterval == 0 {
+		cleanupInterval = time.Minute
+	}
+
+	s := &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		clock:   clock.Real{},
+		stop:    make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// the ticker is created before return, so a fake clock can be advanced right away
+	go s.janitor(s.clock.NewTicker(cleanupInterval))
+
+	return s
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+
+	e, ok := s.entries[key]
+	if !ok || e.expired(now) {
+		e = &memoryEntry{}
+		if ttl > 0 {
+			e.expireAt = now.Add(ttl)
+		}
+		s.entries[key] = e
+	}
+
+	e.value += delta
+
+	return e.value, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.expired(s.clock.Now()) {
+		return 0, nil
+	}
+
+	return e.value, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &memoryEntry{value: value}
+	if ttl > 0 {
+		e.expireAt = s.clock.Now().Add(ttl)
+	}
+	s.entries[key] = e
+
+	return nil
+}
+
+func (s *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+
+	e, ok := s.entries[key]
+	if !ok || e.expired(now) || e.expireAt.IsZero() {
+		return 0, nil
+	}
+
+	return e.expireAt.Sub(now), nil
+}
+
+func (s *MemoryStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+
+	keys := make([]string, 0)
+	for key, e := range s.entries {
+		if strings.HasPrefix(key, prefix) && !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) janitor(ticker clock.Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			now := s.clock.Now()
+
+			s.mu.Lock()
+			for key, e := range s.entries {
+				if e.expired(now) {
+					delete(s.entries, key)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
@@ -0,0 +1,319 @@
+// Package storetest is a conformance suite of limiter.Store implementations. Every backend must pass it:
+//
+//	func TestRedisStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) (limiter.Store, func(time.Duration)) {
+//			...
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory return an empty store and a func which moves the time of counters expiration forward.
+// The store is closed by the suite
+type Factory func(t *testing.T) (store limiter.Store, advance func(d time.Duration))
+
+// Run runs the suite against stores created by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store limiter.Store, advance func(d time.Duration))
+	}{
+		{"counters", testCounters},
+		{"expiry", testExpiry},
+		{"keys and delete", testKeys},
+		{"atomic incr", testAtomicIncr},
+		{"burst", testBurst},
+		{"cost", testCost},
+		{"concurrent checks", testConcurrentChecks},
+		{"window edges", testWindowEdges},
+		{"reset", testReset},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store, advance := newStore(t)
+			defer store.Close()
+
+			tc.fn(t, store, advance)
+		})
+	}
+}
+
+func testCounters(t *testing.T, store limiter.Store, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	n, err := store.Get(ctx, "missing")
+	require.NoError(t, err)
+	assert.Zero(t, n, "missing counter is 0")
+
+	n, err = store.Incr(ctx, "a", 3, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	n, err = store.Incr(ctx, "a", -1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n, "negative delta refunds")
+
+	require.NoError(t, store.Set(ctx, "a", 10, 0))
+	n, err = store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+
+	ttl, err := store.TTL(ctx, "a")
+	require.NoError(t, err)
+	assert.Zero(t, ttl, "counter without expiration")
+
+	ttl, err = store.TTL(ctx, "missing")
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+}
+
+func testExpiry(t *testing.T, store limiter.Store, advance func(time.Duration)) {
+	ctx := context.Background()
+
+	_, err := store.Incr(ctx, "a", 1, 10*time.Second)
+	require.NoError(t, err)
+
+	_, err = store.Incr(ctx, "forever", 1, 0)
+	require.NoError(t, err)
+
+	advance(5 * time.Second)
+
+	// ttl is applied only when the counter is created
+	n, err := store.Incr(ctx, "a", 1, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	ttl, err := store.TTL(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, ttl)
+
+	advance(5*time.Second - time.Millisecond)
+	n, err = store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n, "alive until ttl")
+
+	advance(time.Millisecond)
+	n, err = store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Zero(t, n, "expired at ttl")
+
+	n, err = store.Incr(ctx, "a", 1, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "expired counter starts from 0")
+
+	ttl, err = store.TTL(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, ttl, "new ttl of the recreated counter")
+
+	// Set replaces ttl
+	require.NoError(t, store.Set(ctx, "a", 5, time.Second))
+	ttl, err = store.TTL(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, ttl)
+
+	advance(time.Hour)
+	n, err = store.Get(ctx, "forever")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "counter without ttl never expires")
+}
+
+func testKeys(t *testing.T, store limiter.Store, advance func(time.Duration)) {
+	ctx := context.Background()
+
+	for _, key := range []string{"pn:ban:a", "pn:ban:b", "pn:level:a"} {
+		_, err := store.Incr(ctx, key, 1, 0)
+		require.NoError(t, err)
+	}
+	_, err := store.Incr(ctx, "pn:ban:expired", 1, time.Second)
+	require.NoError(t, err)
+
+	advance(time.Second)
+
+	keys, err := store.Keys(ctx, "pn:ban:")
+	require.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"pn:ban:a", "pn:ban:b"}, keys, "expired counters are not listed")
+
+	require.NoError(t, store.Delete(ctx, "pn:ban:a", "missing"))
+	require.NoError(t, store.Delete(ctx))
+
+	keys, err = store.Keys(ctx, "pn:")
+	require.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"pn:ban:b", "pn:level:a"}, keys)
+
+	_, err = store.Incr(ctx, "rl:r:[*?]:1", 1, 0)
+	require.NoError(t, err)
+
+	keys, err = store.Keys(ctx, "rl:r:[*?]:")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rl:r:[*?]:1"}, keys, "prefix is not a pattern")
+}
+
+func testAtomicIncr(t *testing.T, store limiter.Store, _ func(time.Duration)) {
+	const workers, incrs = 20, 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < incrs; j++ {
+				if _, err := store.Incr(context.Background(), "a", 1, time.Hour); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := store.Get(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*incrs), n)
+}
+
+// newLimiter return limiter with the rule and a fake clock in the middle of an hour window,
+// so windows don't change while the store time is moved
+func newLimiter(t *testing.T, store limiter.Store, rule string) (*limiter.Limiter, *clock.Fake) {
+	rules, err := limiter.ParseRules("[" + rule + "]")
+	require.NoError(t, err)
+
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC))
+
+	return limiter.New(nil, store, rules, limiter.WithClock(c)), c
+}
+
+func check(t *testing.T, l *limiter.Limiter, key string, cost int64) limiter.Decision {
+	t.Helper()
+
+	d, err := l.Check(context.Background(), limiter.Request{Key: key, Route: "/api", Cost: cost})
+	require.NoError(t, err)
+
+	return d
+}
+
+func testBurst(t *testing.T, store limiter.Store, _ func(time.Duration)) {
+	for _, algorithm := range []limiter.Algorithm{limiter.AlgorithmFixedWindow, limiter.AlgorithmSlidingWindow} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			l, _ := newLimiter(t, store, fmt.Sprintf(`{"name": "%s", "limit": 5, "window": "1h", "algorithm": "%s"}`, algorithm, algorithm))
+
+			for i := 0; i < 5; i++ {
+				d := check(t, l, "a", 1)
+				assert.True(t, d.Allowed, "request %d of the burst", i)
+				assert.Equal(t, int64(4-i), d.Remaining)
+			}
+
+			d := check(t, l, "a", 1)
+			assert.False(t, d.Allowed)
+			assert.Zero(t, d.Remaining)
+			assert.Positive(t, d.RetryAfter)
+
+			assert.True(t, check(t, l, "b", 1).Allowed, "keys are limited separately")
+		})
+	}
+}
+
+func testCost(t *testing.T, store limiter.Store, _ func(time.Duration)) {
+	l, _ := newLimiter(t, store, `{"name": "r", "limit": 10, "window": "1h"}`)
+
+	d := check(t, l, "a", 0)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, int64(9), d.Remaining, "cost 0 is counted as 1")
+
+	d = check(t, l, "a", 7)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, int64(2), d.Remaining)
+
+	d = check(t, l, "a", 3)
+	assert.False(t, d.Allowed, "cost over remaining quota")
+
+	d = check(t, l, "a", 2)
+	assert.True(t, d.Allowed, "rejected request doesn't consume quota")
+	assert.Zero(t, d.Remaining)
+
+	assert.False(t, check(t, l, "b", 11).Allowed, "cost over the limit")
+}
+
+func testConcurrentChecks(t *testing.T, store limiter.Store, _ func(time.Duration)) {
+	const limit, requests = 50, 200
+
+	l, _ := newLimiter(t, store, fmt.Sprintf(`{"name": "r", "limit": %d, "window": "1h"}`, limit))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			d, err := l.Check(context.Background(), limiter.Request{Key: "a"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if d.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, limit, allowed, "no request is allowed over the limit")
+}
+
+func testWindowEdges(t *testing.T, store limiter.Store, advance func(time.Duration)) {
+	l, c := newLimiter(t, store, `{"name": "r", "limit": 1, "window": "1m"}`)
+
+	c.Set(time.Date(2024, 5, 1, 10, 0, 59, int(999*time.Millisecond), time.UTC))
+	d := check(t, l, "a", 1)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC), d.ResetAt)
+
+	d = check(t, l, "a", 1)
+	assert.False(t, d.Allowed, "last millisecond of the window")
+	assert.Equal(t, time.Millisecond, d.RetryAfter)
+
+	// the counter ttl is the time left in the window
+	c.Advance(time.Millisecond)
+	advance(time.Millisecond)
+
+	d = check(t, l, "a", 1)
+	assert.True(t, d.Allowed, "first instant of the next window")
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 2, 0, 0, time.UTC), d.ResetAt)
+}
+
+func testReset(t *testing.T, store limiter.Store, _ func(time.Duration)) {
+	l, _ := newLimiter(t, store, `{"name": "r", "limit": 1, "window": "1h", "algorithm": "sliding_window"}`)
+
+	assert.True(t, check(t, l, "a", 1).Allowed)
+	assert.True(t, check(t, l, "b", 1).Allowed)
+	assert.False(t, check(t, l, "a", 1).Allowed)
+
+	require.NoError(t, l.Reset(context.Background(), "a"))
+
+	assert.True(t, check(t, l, "a", 1).Allowed, "quota of the key is reset")
+	assert.False(t, check(t, l, "b", 1).Allowed, "other keys are not reset")
+}
@@ -0,0 +1,268 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// lockID - postgres advisory lock, so instances don't apply migrations concurrently
+const lockID = 7230945118
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a pair of up and down sql scripts, e.g. 000001_create_limit_overrides.up.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads migrations from fsys sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, f := range files {
+		m := fileRe.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version %s: %v", f.Name(), err)
+		}
+
+		data, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mg
+		}
+
+		if mg.Name != m[2] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", mg.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mg.Up = string(data)
+		} else {
+			mg.Down = string(data)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mg.Version, mg.Name)
+		}
+
+		res = append(res, *mg)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+
+	return res, nil
+}
+
+// Status of the migration. AppliedAt is zero if the migration is not applied
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations and keeps applied versions in schema_migrations table
+type Migrator struct {
+	logger     log.Logger
+	db         *postgres.PostgreSQL
+	migrations []Migration
+}
+
+func NewMigrator(logger log.Logger, db *postgres.PostgreSQL, migrations []Migration) *Migrator {
+	return &Migrator{
+		logger:     logger,
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Up applies n pending migrations in order of versions, all if n <= 0. Return applied migrations
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var res []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			if n > 0 && len(res) == n {
+				break
+			}
+
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, mg.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mg.Version, mg.Name); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %v", mg.Version, mg.Name, err)
+			}
+
+			m.logger.Infof("migration %d_%s applied", mg.Version, mg.Name)
+			res = append(res, mg)
+		}
+
+		return nil
+	})
+
+	return res, err
+}
+
+// Down reverts n last applied migrations. Return reverted migrations
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var res []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(res) < n; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+
+			if mg.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", mg.Version, mg.Name)
+			}
+
+			if err := m.apply(ctx, conn, mg.Down, `DELETE FROM schema_migrations WHERE version = $1`, mg.Version); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %v", mg.Version, mg.Name, err)
+			}
+
+			m.logger.Infof("migration %d_%s reverted", mg.Version, mg.Name)
+			res = append(res, mg)
+		}
+
+		return nil
+	})
+
+	return res, err
+}
+
+// Status return status of all migrations
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			res = append(res, Status{Migration: mg, AppliedAt: applied[mg.Version]})
+		}
+
+		return nil
+	})
+
+	return res, err
+}
+
+// withLock runs fn on one connection under advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %v", err)
+	}
+
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			m.logger.Errorf("failed to unlock migrations: %v", err)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`,
+	); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// applied return applied versions with time
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		res[version] = appliedAt
+	}
+
+	return res, rows.Err()
+}
+
+// apply runs the script and updates schema_migrations in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, script, query string, args ...any) error {
+	return conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() != 1 {
+			return errors.New("schema_migrations is not updated")
+		}
+
+		return nil
+	})
+}
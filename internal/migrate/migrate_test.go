@@ -0,0 +1,42 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/Harardin/rate-limit/internal/migrate"
+	"github.com/Harardin/rate-limit/sql/migrations"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	res, err := migrate.Load(fstest.MapFS{
+		"000002_add_column.up.sql":     {Data: []byte("ALTER TABLE t ADD c TEXT;")},
+		"000001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (id INT);")},
+		"000001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"migrations.go":                {Data: []byte("package migrations")},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, res, 2)
+	assert.Equal(t, migrate.Migration{Version: 1, Name: "create_table", Up: "CREATE TABLE t (id INT);", Down: "DROP TABLE t;"}, res[0])
+	assert.Equal(t, int64(2), res[1].Version)
+	assert.Empty(t, res[1].Down)
+
+	_, err = migrate.Load(fstest.MapFS{
+		"000001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+	})
+	assert.Error(t, err, "up script is required")
+
+	t.Run("embedded migrations", func(t *testing.T) {
+		res, err := migrate.Load(migrations.FS)
+		require.NoError(t, err)
+
+		for i, mg := range res {
+			assert.Equal(t, int64(i+1), mg.Version)
+			assert.NotEmpty(t, mg.Down, mg.Name)
+		}
+	})
+}
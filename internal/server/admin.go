@@ -0,0 +1,279 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/admin"
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/internal/usage"
+
+	"github.com/goccy/go-json"
+)
+
+// registerAdminHandlers registers admin api. All handlers require `Authorization: Bearer <ADMIN_TOKEN>`
+func (s *Server) registerAdminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/v1/overrides", s.adminAuth(s.HandleListOverrides))
+	mux.HandleFunc("PUT /admin/v1/overrides", s.adminAuth(s.HandleSetOverride))
+	mux.HandleFunc("DELETE /admin/v1/overrides/{key}", s.adminAuth(s.HandleDeleteOverride))
+	mux.HandleFunc("GET /admin/v1/keys/{key}", s.adminAuth(s.HandleInspectKey))
+	mux.HandleFunc("POST /admin/v1/keys/{key}/reset", s.adminAuth(s.HandleResetKey))
+	mux.HandleFunc("GET /admin/v1/bans", s.adminAuth(s.HandleListBans))
+	mux.HandleFunc("DELETE /admin/v1/bans/{key}", s.adminAuth(s.HandleLiftBan))
+	mux.HandleFunc("PUT /admin/v1/tenants/{id}/plan", s.adminAuth(s.HandleAssignPlan))
+	mux.HandleFunc("GET /admin/v1/plans", s.adminAuth(s.tenantsOnly(s.HandleListPlans)))
+	mux.HandleFunc("GET /admin/v1/plans/{id}", s.adminAuth(s.tenantsOnly(s.HandleGetPlan)))
+	mux.HandleFunc("PUT /admin/v1/plans/{id}", s.adminAuth(s.tenantsOnly(s.HandleSavePlan)))
+	mux.HandleFunc("DELETE /admin/v1/plans/{id}", s.adminAuth(s.tenantsOnly(s.HandleDeletePlan)))
+	mux.HandleFunc("GET /admin/v1/tenants", s.adminAuth(s.tenantsOnly(s.HandleListTenants)))
+	mux.HandleFunc("POST /admin/v1/tenants", s.adminAuth(s.tenantsOnly(s.HandleCreateTenant)))
+	mux.HandleFunc("GET /admin/v1/tenants/{id}", s.adminAuth(s.tenantsOnly(s.HandleGetTenant)))
+	mux.HandleFunc("PUT /admin/v1/tenants/{id}", s.adminAuth(s.tenantsOnly(s.HandleUpdateTenant)))
+	mux.HandleFunc("DELETE /admin/v1/tenants/{id}", s.adminAuth(s.tenantsOnly(s.HandleDeleteTenant)))
+	mux.HandleFunc("GET /admin/v1/tenants/{id}/keys", s.adminAuth(s.tenantsOnly(s.HandleListAPIKeys)))
+	mux.HandleFunc("POST /admin/v1/tenants/{id}/keys", s.adminAuth(s.tenantsOnly(s.HandleCreateAPIKey)))
+	mux.HandleFunc("DELETE /admin/v1/tenants/{id}/keys/{hash}", s.adminAuth(s.tenantsOnly(s.HandleRevokeAPIKey)))
+	mux.HandleFunc("GET /admin/v1/usage", s.adminAuth(s.HandleUsage))
+}
+
+func (s *Server) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.currentConfig().Admin.Token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+type setOverrideRequest struct {
+	limiter.Override
+	// TTL is used if expires_at is empty, e.g. "1h"
+	TTL limiter.Duration `json:"ttl"`
+}
+
+func (s *Server) HandleSetOverride(w http.ResponseWriter, r *http.Request) {
+	var req setOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	o := req.Override
+	if o.ExpiresAt.IsZero() && req.TTL > 0 {
+		o.ExpiresAt = s.clock.Now().Add(time.Duration(req.TTL))
+	}
+
+	o, err := s.admin.SetOverride(r.Context(), o)
+	if errors.Is(err, admin.ErrValidation) {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.adminError(w, "failed to set override", err)
+		return
+	}
+
+	s.writeJSON(w, o)
+}
+
+func (s *Server) HandleListOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := s.admin.ListOverrides(r.Context())
+	if err != nil {
+		s.adminError(w, "failed to list overrides", err)
+		return
+	}
+
+	s.writeJSON(w, overrides)
+}
+
+// HandleDeleteOverride removes the override of the key. Rule is passed with `rule` query param, empty means all rules override
+func (s *Server) HandleDeleteOverride(w http.ResponseWriter, r *http.Request) {
+	if err := s.admin.DeleteOverride(r.Context(), r.PathValue("key"), r.URL.Query().Get("rule")); err != nil {
+		s.adminError(w, "failed to delete override", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleInspectKey return the key state in all rules
+func (s *Server) HandleInspectKey(w http.ResponseWriter, r *http.Request) {
+	state, err := s.limiter.Inspect(r.Context(), r.PathValue("key"))
+	if err != nil {
+		s.adminError(w, "failed to inspect key", err)
+		return
+	}
+
+	s.writeJSON(w, state)
+}
+
+// HandleResetKey removes counters and the ban of the key
+func (s *Server) HandleResetKey(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if err := s.limiter.Reset(r.Context(), key); err != nil {
+		s.adminError(w, "failed to reset key", err)
+		return
+	}
+
+	s.logger.Infof("counters of key \"%s\" were reset", key)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListBans return active bans of repeat offenders
+func (s *Server) HandleListBans(w http.ResponseWriter, r *http.Request) {
+	p := s.limiter.Penalizer()
+	if p == nil {
+		http.Error(w, "Penalties are disabled", http.StatusNotFound)
+		return
+	}
+
+	bans, err := p.List(r.Context())
+	if err != nil {
+		s.adminError(w, "failed to list bans", err)
+		return
+	}
+
+	s.writeJSON(w, bans)
+}
+
+// HandleLiftBan removes the ban of the key
+func (s *Server) HandleLiftBan(w http.ResponseWriter, r *http.Request) {
+	p := s.limiter.Penalizer()
+	if p == nil {
+		http.Error(w, "Penalties are disabled", http.StatusNotFound)
+		return
+	}
+
+	key := r.PathValue("key")
+	if err := p.Lift(r.Context(), key); err != nil {
+		s.adminError(w, "failed to lift ban", err)
+		return
+	}
+
+	s.logger.Infof("ban of key \"%s\" was lifted", key)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type assignPlanRequest struct {
+	PlanID string `json:"plan_id"`
+}
+
+// HandleAssignPlan changes the plan of the tenant, new limits are applied on all instances
+func (s *Server) HandleAssignPlan(w http.ResponseWriter, r *http.Request) {
+	if s.tenants == nil {
+		http.Error(w, "Tenants are disabled", http.StatusNotFound)
+		return
+	}
+
+	tenantID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad request: bad tenant id", http.StatusBadRequest)
+		return
+	}
+
+	var req assignPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PlanID == "" {
+		http.Error(w, "bad request: plan_id is required", http.StatusBadRequest)
+		return
+	}
+
+	err = s.tenants.Repository().AssignPlan(r.Context(), tenantID, req.PlanID)
+	if err != nil {
+		s.tenantError(w, "failed to assign plan", err)
+		return
+	}
+
+	s.logger.Infof("tenant %d is moved to plan \"%s\"", tenantID, req.PlanID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUsage exports usage between `from` and `to` (RFC3339) as json or csv.
+//
+// Optional params: `tenant`, `key`, `route` filters, `group_by` comma separated columns (bucket, tenant, key, route), `format` json or csv.
+func (s *Server) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if s.usage == nil {
+		http.Error(w, "Usage metering is disabled", http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+
+	from, err := time.Parse(time.RFC3339, params.Get("from"))
+	if err != nil {
+		http.Error(w, "bad request: bad from", http.StatusBadRequest)
+		return
+	}
+
+	to, err := time.Parse(time.RFC3339, params.Get("to"))
+	if err != nil {
+		http.Error(w, "bad request: bad to", http.StatusBadRequest)
+		return
+	}
+
+	q := usage.Query{
+		From:   from,
+		To:     to,
+		Tenant: params.Get("tenant"),
+		Key:    params.Get("key"),
+		Route:  params.Get("route"),
+	}
+	if groupBy := params.Get("group_by"); groupBy != "" {
+		q.GroupBy = strings.Split(groupBy, ",")
+	}
+
+	if err := q.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	format := params.Get("format")
+	if format == "" {
+		format = usage.FormatJSON
+	}
+	if format != usage.FormatJSON && format != usage.FormatCSV {
+		http.Error(w, "bad request: format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := s.usage.Repository().Query(r.Context(), q)
+	if err != nil {
+		s.adminError(w, "failed to query usage", err)
+		return
+	}
+
+	if format == usage.FormatJSON {
+		s.writeJSON(w, rows)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+
+	if err := usage.WriteCSV(w, q.GroupBy, rows); err != nil {
+		s.logger.Errorf("failed to write response: %v", err)
+	}
+}
+
+func (s *Server) adminError(w http.ResponseWriter, msg string, err error) {
+	s.logger.Errorf("%s: %v", msg, err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Errorf("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+)
+
+// limitConcurrency rejects requests over the adaptive concurrency limit with 503.
+// Responses with 5xx status reduce the limit.
+func (s *Server) limitConcurrency(next http.HandlerFunc) http.HandlerFunc {
+	if s.concurrency == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := s.concurrency.Acquire()
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			token.Release(rw.status >= http.StatusInternalServerError)
+		}()
+
+		next(rw, r)
+	}
+}
+
+// SetConcurrencyLimit implements concurrency.Metrics
+func (s *Server) SetConcurrencyLimit(limit int) {
+	if s.pm != nil {
+		s.pm.SetConcurrencyLimit(limit)
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
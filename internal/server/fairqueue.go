@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Harardin/rate-limit/internal/fairqueue"
+)
+
+// anonymousTenant shares one queue between requests without a known tenant
+const anonymousTenant = "anonymous"
+
+// fairQueue shares capacity between tenants when it is saturated. Tenant is resolved by the api key of the request
+func (s *Server) fairQueue(next http.HandlerFunc) http.HandlerFunc {
+	if s.scheduler == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant, weight := s.tenantWeight(requestAPIKey(r))
+
+		release, err := s.scheduler.Acquire(r.Context(), tenant, weight)
+		if errors.Is(err, fairqueue.ErrQueueFull) || errors.Is(err, fairqueue.ErrQueueTimeout) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			// the client is gone
+			return
+		}
+		defer release()
+
+		next(w, r)
+	}
+}
+
+func (s *Server) tenantWeight(apiKey string) (string, int) {
+	if s.plans == nil || apiKey == "" {
+		return anonymousTenant, s.weights[anonymousTenant]
+	}
+
+	plan, ok := s.plans.ResolvePlan(apiKey)
+	if !ok {
+		return anonymousTenant, s.weights[anonymousTenant]
+	}
+
+	if w, ok := s.weights[plan.Tenant]; ok {
+		return plan.Tenant, w
+	}
+
+	return plan.Tenant, s.weights["plan:"+plan.Name]
+}
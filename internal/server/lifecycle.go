@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/Harardin/rate-limit/pkg/httpserver"
+	"github.com/Harardin/rate-limit/pkg/lifecycle"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+	"github.com/Harardin/rate-limit/pkg/redisclient"
+)
+
+// Component names
+const (
+	ComponentPostgres = "postgres"
+	ComponentRedis    = "redis"
+	ComponentRabbit   = "rabbit"
+	ComponentAdmin    = "admin"
+	ComponentTenants  = "tenants"
+	ComponentUsage    = "usage"
+	ComponentEvents   = "events"
+	ComponentControl  = "control"
+	ComponentShedder  = "shedder"
+	ComponentHTTP     = "http"
+	ComponentMetrics  = "prometheus"
+	ComponentHC       = "hc"
+)
+
+// Register registers server components in the lifecycle manager.
+//
+// Connections are opened in New and reopened with the current config when their envs are changed.
+// Workers depend on the connections they use, the http server is started after them and stopped before them.
+// Health check server is started when the service is ready and stopped first.
+func (s *Server) Register(m *lifecycle.Manager) error {
+	var registered []string
+	register := func(name string, c lifecycle.Component, opts ...lifecycle.ComponentOption) error {
+		if err := m.Register(name, c, opts...); err != nil {
+			return err
+		}
+
+		registered = append(registered, name)
+
+		return nil
+	}
+
+	if s.pm != nil {
+		if err := register(ComponentMetrics, lifecycle.Hooks(
+			func(ctx context.Context) error {
+				s.pm.SetConfig(s.currentConfig().Prometheus)
+				return s.pm.Start(ctx)
+			},
+			func(ctx context.Context) error {
+				s.pm.Stop(ctx)
+				return nil
+			},
+		), lifecycle.Envs("PROMETHEUS_*")); err != nil {
+			return err
+		}
+	}
+
+	if s.postgres.Load() != nil {
+		if err := register(ComponentPostgres, reconnectable(s.reconnectPostgres, s.closePostgres), lifecycle.Envs("POSTGRES_*")); err != nil {
+			return err
+		}
+	}
+
+	if s.redis.Load() != nil {
+		if err := register(ComponentRedis, reconnectable(s.reconnectRedis, s.closeRedis), lifecycle.Envs("REDIS_*")); err != nil {
+			return err
+		}
+	}
+
+	if s.rabbitService != nil {
+		if err := register(ComponentRabbit, reconnectable(s.reconnectRabbit, s.closeRabbit), lifecycle.Envs("RABBIT_*")); err != nil {
+			return err
+		}
+	}
+
+	var workers []worker
+	if s.admin != nil {
+		workers = append(workers, worker{ComponentAdmin, s.admin.Start, []string{ComponentPostgres}})
+	}
+	if s.tenants != nil {
+		workers = append(workers, worker{ComponentTenants, s.tenants.Start, []string{ComponentPostgres}})
+	}
+	if s.usage != nil {
+		workers = append(workers, worker{ComponentUsage, s.usage.Start, []string{ComponentPostgres}})
+	}
+	if s.events != nil {
+		workers = append(workers, worker{ComponentEvents, s.events.Start, []string{ComponentRabbit}})
+	}
+	if s.control != nil {
+		// commands change counters and bans in the limiter store
+		deps := []string{ComponentRabbit}
+		if s.redis.Load() != nil {
+			deps = append(deps, ComponentRedis)
+		}
+		if s.postgresStore != nil {
+			deps = append(deps, ComponentPostgres)
+		}
+		workers = append(workers, worker{ComponentControl, s.control.Start, deps})
+	}
+	if s.shedder != nil {
+		workers = append(workers, worker{ComponentShedder, s.shedder.Start, nil})
+	}
+
+	for _, w := range workers {
+		var c lifecycle.Component = lifecycle.Run(func(ctx context.Context) error {
+			w.run(ctx)
+			return nil
+		})
+
+		// the publisher writes to a channel of the current rabbitmq connection
+		if w.name == ComponentEvents {
+			c = &eventsComponent{s: s, Component: c}
+		}
+
+		if err := register(w.name, c, lifecycle.DependsOn(w.deps...)); err != nil {
+			return err
+		}
+	}
+
+	web := &httpComponent{s: s}
+	web.Component = lifecycle.Run(web.serve)
+
+	if err := register(
+		ComponentHTTP,
+		web,
+		lifecycle.DependsOn(registered...),
+		lifecycle.Envs("HTTP_*", "HTTP3_*", "TLS_*"),
+	); err != nil {
+		return err
+	}
+
+	if s.hc == nil {
+		return nil
+	}
+
+	return register(ComponentHC, lifecycle.Hooks(
+		func(context.Context) error {
+			s.hc.SetConfig(s.currentConfig().HealthCheck)
+			return s.hc.Start()
+		},
+		func(ctx context.Context) error {
+			s.hc.Stop(ctx)
+			return nil
+		},
+	), lifecycle.DependsOn(ComponentHTTP), lifecycle.Envs("HEALTH_CHECK_*"))
+}
+
+// worker is a background loop which runs until ctx is done
+type worker struct {
+	name string
+	run  func(ctx context.Context)
+	deps []string
+}
+
+// reconnectable return component of a connection which is opened in New. The connection is reopened
+// on start after stop
+func reconnectable(open func(ctx context.Context) error, close func()) lifecycle.Component {
+	closed := false
+
+	return lifecycle.Hooks(
+		func(ctx context.Context) error {
+			if !closed {
+				return nil
+			}
+
+			if err := open(ctx); err != nil {
+				return err
+			}
+			closed = false
+
+			return nil
+		},
+		func(context.Context) error {
+			close()
+			closed = true
+
+			return nil
+		},
+	)
+}
+
+// reconnectPostgres replaces the connection of repositories and the limiter store. Components using postgres depend on it,
+// so they are stopped before the previous connection is closed
+func (s *Server) reconnectPostgres(ctx context.Context) error {
+	cfg := s.currentConfig()
+	db, err := postgres.NewPostgreSQL(ctx, s.logger, cfg.Postgres, cfg.GetPostgresAddr())
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %v", err)
+	}
+
+	s.postgres.Store(db)
+
+	if s.admin != nil {
+		s.admin.SetDB(db)
+	}
+	if s.tenants != nil {
+		s.tenants.SetDB(db)
+	}
+	if s.usage != nil {
+		s.usage.SetDB(db)
+	}
+	if s.postgresStore != nil {
+		s.postgresStore.SetDB(db)
+	}
+
+	return nil
+}
+
+func (s *Server) closePostgres() {
+	s.postgres.Load().Close()
+}
+
+// reconnectRedis replaces the client of the limiter store. Components using the store depend on redis,
+// so they are stopped before the previous client is closed
+func (s *Server) reconnectRedis(ctx context.Context) error {
+	cfg := s.currentConfig()
+	r, err := redisclient.NewRedis(ctx, s.logger, cfg.Redis, cfg.GetRedisAddr())
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	s.redis.Store(r)
+	s.redisStore.SetClient(r)
+
+	return nil
+}
+
+func (s *Server) closeRedis() {
+	if err := s.redis.Load().Close(); err != nil {
+		s.logger.Errorf("failed to close redis connection: %v", err)
+	}
+}
+
+func (s *Server) reconnectRabbit(context.Context) error {
+	cfg := s.currentConfig()
+	if err := s.rabbitService.NewRabbitMQConnection(cfg.Rabbit, cfg.GetRabbitAddr()); err != nil {
+		return fmt.Errorf("failed to connect to rabbitmq: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Server) closeRabbit() {
+	if err := s.rabbitService.CloseRabbitMQConnection(); err != nil {
+		s.logger.Errorf("failed to stop rabbit: %v", err)
+	}
+}
+
+// eventsComponent opens a new rabbitmq channel for the publisher on every start
+type eventsComponent struct {
+	s *Server
+	lifecycle.Component
+}
+
+func (c *eventsComponent) Start(ctx context.Context) error {
+	w, err := c.s.rabbitService.NewWriter()
+	if err != nil {
+		return fmt.Errorf("failed to open rabbitmq writer: %v", err)
+	}
+
+	c.s.events.SetWriter(w)
+
+	return c.Component.Start(ctx)
+}
+
+// httpComponent creates the http server with the current config on every start. Listeners are bound in Start,
+// so a busy address fails the start instead of stopping the running service
+type httpComponent struct {
+	s *Server
+	lifecycle.Component
+
+	ln net.Listener
+	pc net.PacketConn
+}
+
+func (c *httpComponent) Start(ctx context.Context) error {
+	srv, err := httpserver.New(c.s.logger, c.s.currentConfig().HTTP, c.s.handler)
+	if err != nil {
+		return err
+	}
+
+	ln, pc, err := srv.Listen()
+	if err != nil {
+		return err
+	}
+
+	c.s.http = srv
+	c.ln, c.pc = ln, pc
+
+	if err := c.Component.Start(ctx); err != nil {
+		ln.Close()
+		if pc != nil {
+			pc.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *httpComponent) serve(ctx context.Context) error {
+	return c.s.http.ServeListener(ctx, c.ln, c.pc)
+}
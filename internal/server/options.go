@@ -0,0 +1,36 @@
+package server
+
+import (
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+)
+
+type Option func(*Options)
+
+type Options struct {
+	// Clock of the limiter, its memory store and health checks. Default clock.Real
+	Clock clock.Clock
+	// Plans resolves tenant plans by api key instead of the tenants cache
+	Plans limiter.PlanResolver
+	// ReloadConfig re-reads the config source on the reload_rules control command, changed rules are applied by
+	// ReloadRules. Default - rules are applied from the current config
+	ReloadConfig func()
+}
+
+func WithClock(v clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = v
+	}
+}
+
+func WithPlans(v limiter.PlanResolver) Option {
+	return func(o *Options) {
+		o.Plans = v
+	}
+}
+
+func WithReloadConfig(v func()) Option {
+	return func(o *Options) {
+		o.ReloadConfig = v
+	}
+}
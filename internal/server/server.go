@@ -5,16 +5,33 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
-	"sync"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/Harardin/rate-limit/internal/admin"
+	"github.com/Harardin/rate-limit/internal/concurrency"
 	"github.com/Harardin/rate-limit/internal/config"
+	"github.com/Harardin/rate-limit/internal/control"
+	"github.com/Harardin/rate-limit/internal/events"
+	"github.com/Harardin/rate-limit/internal/fairqueue"
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/internal/shedding"
+	"github.com/Harardin/rate-limit/internal/tenant"
+	"github.com/Harardin/rate-limit/internal/usage"
+	"github.com/Harardin/rate-limit/pkg/clock"
 	"github.com/Harardin/rate-limit/pkg/hc"
+	"github.com/Harardin/rate-limit/pkg/httpserver"
 	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/postgres"
 	"github.com/Harardin/rate-limit/pkg/prometheus"
 	"github.com/Harardin/rate-limit/pkg/rabbitbus"
+	"github.com/Harardin/rate-limit/pkg/redisclient"
+
+	"github.com/goccy/go-json"
 )
 
 type Server struct {
@@ -22,42 +39,315 @@ type Server struct {
 
 	msg chan string
 
-	requestersList map[string]time.Time // in real better to use redis
+	limiter      *limiter.Limiter
+	limiterStore limiter.Store
+	// concurrency is nil if adaptive concurrency limit is disabled
+	concurrency *concurrency.Limiter
+	// shedder is nil if load shedding is disabled
+	shedder    *shedding.Shedder
+	classifier *shedding.Classifier
+	// scheduler is nil if fair queuing is disabled
+	scheduler *fairqueue.Scheduler
+	weights   map[string]int
+
+	// connections are replaced on reconnect, components using them are restarted with them
+	redis    atomic.Pointer[redisclient.Redis]
+	postgres atomic.Pointer[postgres.PostgreSQL]
+	// redisStore is the limiter store if it is redis
+	redisStore *limiter.RedisStore
+	// postgresStore is the limiter store if it is postgres
+	postgresStore *limiter.PostgresStore
 
-	mx sync.RWMutex
+	admin   *admin.Service
+	tenants *tenant.Cache
+	// plans is nil if tenants are disabled
+	plans   limiter.PlanResolver
+	usage   *usage.Meter
+	events  *events.Publisher
+	control *control.Consumer
 
 	logger log.Logger
-	config *config.Config
-	hc     *hc.Server
-	pm     *prometheus.Server
+	// config is replaced on changes in consul, use currentConfig to read it
+	config *atomic.Pointer[config.Config]
+	// reload re-reads the config source, nil if the config is not reloaded
+	reload func()
+	clock  clock.Clock
+	// http is created with the current config when the http component is started
+	http    *httpserver.Server
+	handler http.Handler
+	hc      *hc.Server
+	pm      *prometheus.Server
 
 	// rabbit service
 	rabbitService *rabbitbus.Service
 }
 
-func New(logger log.Logger, cfg *config.Config) (*Server, error) {
+// New return server with the config loaded from current. current may be nil, then the default limiter rules are used
+func New(logger log.Logger, current *atomic.Pointer[config.Config], opts ...Option) (*Server, error) {
+	options := Options{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var cfg *config.Config
+	if current != nil {
+		cfg = current.Load()
+	}
+
 	s := &Server{
-		logger:         logger,
-		config:         cfg,
-		msg:            make(chan string, 1),
-		requestersList: make(map[string]time.Time),
+		logger: logger,
+		config: current,
+		clock:  options.Clock,
+		plans:  options.Plans,
+		reload: options.ReloadConfig,
+		msg:    make(chan string, 1),
+	}
+
+	if cfg == nil {
+		s.limiterStore = limiter.NewMemoryStore(0, limiter.WithStoreClock(s.clock))
+		s.limiter = limiter.New(logger, s.limiterStore, limiter.DefaultRules(), limiter.WithMetrics(s), limiter.WithClock(s.clock))
+		s.handler = s.routes()
+		s.http, _ = httpserver.New(logger, httpserver.Config{}, s.handler)
+		return s, nil
+	}
+
+	rules, err := cfg.Limiter.GetRules()
+	if err != nil {
+		return nil, err
+	}
+
+	s.pm = prometheus.NewServer(logger, cfg.Prometheus, cfg.ServiceName)
+
+	if cfg.Concurrency.Enabled {
+		s.concurrency = concurrency.NewLimiter(cfg.Concurrency, s, concurrency.WithClock(s.clock))
+	}
+
+	if err := s.initLimiterStore(); err != nil {
+		return nil, err
+	}
+
+	limiterOpts := []limiter.Option{limiter.WithMetrics(s), limiter.WithClock(s.clock)}
+
+	if cfg.Limiter.Penalty.Enabled {
+		penalizer, err := limiter.NewPenalizer(s.limiterStore, cfg.Limiter.Penalty, limiter.WithPenalizerClock(s.clock))
+		if err != nil {
+			return nil, err
+		}
+		limiterOpts = append(limiterOpts, limiter.WithPenalizer(penalizer))
+	}
+
+	if cfg.Tenants.Enabled {
+		if err := s.initPostgres(); err != nil {
+			return nil, err
+		}
+
+		s.tenants = tenant.NewCache(logger, s.postgres.Load(), cfg.Tenants, tenant.WithClock(s.clock))
+		if s.plans == nil {
+			s.plans = s.tenants
+		}
+	}
+
+	if s.plans != nil {
+		limiterOpts = append(limiterOpts, limiter.WithPlans(s.plans))
+	}
+
+	if cfg.Usage.Enabled {
+		if err := s.initPostgres(); err != nil {
+			return nil, err
+		}
+
+		s.usage = usage.NewMeter(logger, s.postgres.Load(), cfg.Usage, usage.WithClock(s.clock))
+		limiterOpts = append(limiterOpts, limiter.WithUsage(s.usage))
+	}
+
+	if cfg.Events.Enabled {
+		if err := s.initRabbit(); err != nil {
+			return nil, err
+		}
+
+		// writer is opened when the component is started
+		s.events = events.NewPublisher(logger, nil, cfg.Events, events.WithClock(s.clock))
+		limiterOpts = append(limiterOpts, limiter.WithEvents(s.events))
+	}
+
+	s.limiter = limiter.New(logger, s.limiterStore, rules, limiterOpts...)
+
+	if cfg.Shedding.Enabled {
+		s.classifier, err = shedding.NewClassifier(cfg.Shedding, s.plans)
+		if err != nil {
+			return nil, err
+		}
+
+		s.shedder = shedding.NewShedder(cfg.Shedding, shedding.WithClock(s.clock))
+	}
+
+	if cfg.FairQueue.Enabled {
+		s.weights, err = cfg.FairQueue.GetWeights()
+		if err != nil {
+			return nil, err
+		}
+
+		s.scheduler = fairqueue.NewScheduler(cfg.FairQueue, fairqueue.WithClock(s.clock))
 	}
 
+	if cfg.Admin.Enabled {
+		if err := s.initPostgres(); err != nil {
+			return nil, err
+		}
+
+		s.admin = admin.NewService(logger, s.postgres.Load(), s.limiter, cfg.Admin, admin.WithClock(s.clock))
+	}
+
+	if cfg.Control.Enabled {
+		if err := s.initRabbit(); err != nil {
+			return nil, err
+		}
+
+		var overrides control.Overrides
+		if s.admin != nil {
+			overrides = s.admin
+		}
+
+		s.control = control.NewConsumer(logger, s.rabbitService, s.limiter, overrides, s.reloadConfig, cfg.Control, control.WithClock(s.clock))
+	}
+
+	s.initHealthCheck()
+	s.handler = s.routes()
+
 	return s, nil
 }
 
-func (s *Server) Start(ctx context.Context) error {
-	defer s.Stop()
+// currentConfig return the config at the moment, nil if the server is created without config
+func (s *Server) currentConfig() *config.Config {
+	if s.config == nil {
+		return nil
+	}
 
-	return s.StartRateLimiterHTTP(ctx)
+	return s.config.Load()
 }
 
-// this is limiter function example
-func (s *Server) StartRateLimiterHTTP(ctx context.Context) error {
+// initPostgres connects to postgres once, the connection is shared by all components
+func (s *Server) initPostgres() error {
+	if s.postgres.Load() != nil {
+		return nil
+	}
+
+	cfg := s.currentConfig()
+	db, err := postgres.NewPostgreSQL(context.Background(), s.logger, cfg.Postgres, cfg.GetPostgresAddr())
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %v", err)
+	}
+
+	s.postgres.Store(db)
+
+	return nil
+}
+
+// initRabbit connects to rabbitmq once, the connection is shared by all components
+func (s *Server) initRabbit() error {
+	if s.rabbitService != nil {
+		return nil
+	}
+
+	cfg := s.currentConfig()
+	bus, err := rabbitbus.NewBus(s.logger, cfg.Rabbit, cfg.GetRabbitAddr())
+	if err != nil {
+		return fmt.Errorf("failed to connect to rabbitmq: %v", err)
+	}
+
+	s.rabbitService = bus
+
+	return nil
+}
+
+// initLimiterStore init store for limiter counters. Redis and postgres stores share limiter state between all instances
+func (s *Server) initLimiterStore() error {
+	cfg := s.currentConfig()
+	switch cfg.Limiter.Store {
+	case limiter.StoreRedis:
+		r, err := redisclient.NewRedis(context.Background(), s.logger, cfg.Redis, cfg.GetRedisAddr())
+		if err != nil {
+			return fmt.Errorf("failed to connect to redis: %v", err)
+		}
+
+		s.redis.Store(r)
+		s.redisStore = limiter.NewRedisStore(r, cfg.ServiceName)
+		s.limiterStore = s.redisStore
+	case limiter.StorePostgres:
+		if err := s.initPostgres(); err != nil {
+			return err
+		}
 
-	http.HandleFunc("/req", s.HandleRequest)
+		s.postgresStore = limiter.NewPostgresStore(s.postgres.Load(), cfg.ServiceName, 0, limiter.WithPostgresStoreClock(s.clock))
+		s.limiterStore = s.postgresStore
+	default:
+		s.limiterStore = limiter.NewMemoryStore(0, limiter.WithStoreClock(s.clock))
+	}
 
-	return http.ListenAndServe(":20001", nil)
+	return nil
+}
+
+// ReloadRules applies limiter rules from the current config without restarting the server
+func (s *Server) ReloadRules() error {
+	rules, err := s.currentConfig().Limiter.GetRules()
+	if err != nil {
+		return err
+	}
+
+	s.limiter.SetRules(rules)
+	s.logger.Infof("limiter rules reloaded: %d rules", len(rules))
+
+	return nil
+}
+
+// reloadConfig re-reads the config source, changed rules are applied by ReloadRules on the config change.
+// Without a config source rules are applied from the current config
+func (s *Server) reloadConfig() error {
+	if s.reload == nil {
+		return s.ReloadRules()
+	}
+
+	s.reload()
+	s.logger.Info("config reload is requested")
+
+	return nil
+}
+
+// ReloadTLS applies tls certificates from the current config without restarting the server
+func (s *Server) ReloadTLS() error {
+	return s.http.ReloadTLS(s.currentConfig().HTTP.TLS)
+}
+
+// IncrementLimiterDecision implements limiter.Metrics
+func (s *Server) IncrementLimiterDecision(rule, mode, result string) {
+	if s.pm != nil {
+		s.pm.IncrementLimiterDecision(rule, mode, result)
+	}
+}
+
+// routes return handler of the limiter http server. Handlers are registered once, so the server can be restarted
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/req", s.shed(s.fairQueue(s.limitConcurrency(s.HandleRequest))))
+	// the check request is decoded first, so shedding and fair queuing see the api key of the body
+	mux.HandleFunc("/v1/check", s.decodeCheck(s.shed(s.fairQueue(s.limitConcurrency(s.HandleCheck)))))
+
+	if cfg := s.currentConfig(); cfg != nil && cfg.Admin.Enabled {
+		s.registerAdminHandlers(mux)
+	}
+
+	return mux
+}
+
+// Handler return handler of the limiter http api
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// StartRateLimiterHTTP serves limiter http api until ctx is done, then shuts the server down gracefully
+func (s *Server) StartRateLimiterHTTP(ctx context.Context) error {
+	return s.http.Serve(ctx)
 }
 
 func (s *Server) HandleRequest(w http.ResponseWriter, r *http.Request) {
@@ -67,20 +357,26 @@ func (s *Server) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.mx.RLock()
-	if t, ex := s.requestersList[ip]; ex && time.Since(t) < time.Second {
-		http.Error(w, "Too many requests", http.StatusTooManyRequests)
-		s.mx.RUnlock()
-		return
-	}
-	s.mx.RUnlock()
-
 	switch r.Method {
 	case "POST":
-		// storing client IP
-		s.mx.Lock()
-		s.requestersList[ip] = time.Now()
-		s.mx.Unlock()
+		d, err := s.limiter.Check(r.Context(), s.limiterRequest(r, ip))
+		if err != nil {
+			s.logger.Errorf("limiter check error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		s.writeDecisionHeaders(w, d)
+
+		if d.Banned || d.Blocked {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !d.Allowed {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
 
 		t := &http.Response{
 			Status:        "200 OK",
@@ -101,34 +397,190 @@ func (s *Server) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) Stop() {
-	// stop rabbit
-	if s.rabbitService != nil {
-		if err := s.rabbitService.CloseRabbitMQConnection(); err != nil {
-			s.logger.Errorf("failed to stop rabbit: %v", err)
+// AttrClientCert is the request attribute with client certificate identity, can be used in Rule.KeyBy
+const AttrClientCert = "client_cert"
+
+// limiterRequest return limiter request of the client. With mTLS the client certificate identity is used as the key if configured
+func (s *Server) limiterRequest(r *http.Request, ip string) limiter.Request {
+	req := limiter.Request{
+		Key:    ip,
+		APIKey: r.Header.Get("X-API-Key"),
+		Route:  r.URL.Path,
+	}
+
+	cfg := s.currentConfig()
+	if r.TLS == nil || cfg == nil {
+		return req
+	}
+
+	mode := cfg.HTTP.TLS.ClientCertKey
+	if id := httpserver.ClientCertIdentity(r, mode); id != "" {
+		req.Attrs = map[string]string{AttrClientCert: id}
+		if mode != "" {
+			req.Key = id
 		}
 	}
 
-	// stop hc
-	if s.hc != nil {
-		s.hc.Stop(context.Background())
+	return req
+}
+
+type checkRequest struct {
+	Key    string            `json:"key"`
+	APIKey string            `json:"api_key"`
+	Route  string            `json:"route"`
+	Cost   int64             `json:"cost"`
+	Attrs  map[string]string `json:"attrs"`
+}
+
+type checkResponse struct {
+	Allowed   bool   `json:"allowed"`
+	Banned    bool   `json:"banned,omitempty"`
+	Blocked   bool   `json:"blocked,omitempty"`
+	Rule      string `json:"rule,omitempty"`
+	Limit     int64  `json:"limit"`
+	Remaining int64  `json:"remaining"`
+	// RFC3339 time
+	ResetAt    string   `json:"reset_at,omitempty"`
+	RetryAfter float64  `json:"retry_after_seconds,omitempty"`
+	Shadow     []string `json:"shadow,omitempty"`
+}
+
+type checkRequestKey struct{}
+
+// decodeCheck decodes the check request and passes it to next in the request context
+func (s *Server) decodeCheck(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req checkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), checkRequestKey{}, &req)))
 	}
+}
 
-	// stop prometheus
-	if s.pm != nil {
-		s.pm.Stop(context.Background())
+// requestAPIKey return api key of the check request body or X-API-Key header
+func requestAPIKey(r *http.Request) string {
+	if req, ok := r.Context().Value(checkRequestKey{}).(*checkRequest); ok {
+		return req.APIKey
 	}
 
-	s.logger.Info("server stopped")
+	return r.Header.Get("X-API-Key")
 }
 
-func (s *Server) startHealthCheckServer() {
-	// Init HC Server
-	s.hc = hc.NewServer(s.logger, s.config.HealthCheck)
+// HandleCheck is a check API for services which enforce limits by themselves
+func (s *Server) HandleCheck(w http.ResponseWriter, r *http.Request) {
+	req, ok := r.Context().Value(checkRequestKey{}).(*checkRequest)
+	if !ok {
+		// called without the route middlewares
+		s.decodeCheck(s.HandleCheck)(w, r)
+		return
+	}
+
+	lr := limiter.Request{
+		Key:    req.Key,
+		APIKey: req.APIKey,
+		Route:  req.Route,
+		Cost:   req.Cost,
+		Attrs:  req.Attrs,
+	}
+
+	if err := lr.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	d, err := s.limiter.Check(r.Context(), lr)
+	if err != nil {
+		s.logger.Errorf("limiter check error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	res := checkResponse{
+		Allowed:    d.Allowed,
+		Banned:     d.Banned,
+		Blocked:    d.Blocked,
+		Rule:       d.Rule,
+		Limit:      d.Limit,
+		Remaining:  d.Remaining,
+		RetryAfter: d.RetryAfter.Seconds(),
+		Shadow:     d.Shadow,
+	}
+
+	if !d.ResetAt.IsZero() {
+		// calendar windows keep the offset of their time zone
+		res.ResetAt = d.ResetAt.Format(time.RFC3339Nano)
+	}
+
+	s.writeDecisionHeaders(w, d)
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.logger.Errorf("failed to write check response: %v", err)
+	}
+}
+
+// writeDecisionHeaders sets RateLimit-* headers and Retry-After for rejected requests
+func (s *Server) writeDecisionHeaders(w http.ResponseWriter, d limiter.Decision) {
+	if d.Banned || d.Blocked {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(d.RetryAfter.Seconds())), 10))
+		return
+	}
+
+	if d.Rule == "" {
+		return
+	}
+
+	reset := int64(math.Ceil(s.clock.Until(d.ResetAt).Seconds()))
+
+	w.Header().Set("RateLimit-Limit", strconv.FormatInt(d.Limit, 10))
+	w.Header().Set("RateLimit-Remaining", strconv.FormatInt(d.Remaining, 10))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(max(reset, 0), 10))
+	// exact reset instant as unix time
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(d.ResetAt.Unix(), 10))
+
+	if !d.Allowed {
+		retryAfter := int64(math.Ceil(d.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(max(retryAfter, 1), 10))
+	}
+}
+
+// Close releases the limiter store. Connections are closed by their components. Call it once on exit
+func (s *Server) Close() {
+	if err := s.limiterStore.Close(); err != nil {
+		s.logger.Errorf("failed to close limiter store: %v", err)
+	}
+}
+
+// initHealthCheck creates health check server with checks of the connections
+func (s *Server) initHealthCheck() {
+	cfg := s.currentConfig()
+	s.hc = hc.NewServer(s.logger, cfg.HealthCheck, hc.WithClock(s.clock))
 
 	// Register services
-	s.hc.RegisterService(s.config.ServiceName, hc.NewService(0, nil, nil))
+	s.hc.RegisterService(cfg.ServiceName, hc.NewService(0, nil, nil))
+
+	// connections are loaded on each check, so the current connection is checked after reconnect
+	if s.postgres.Load() != nil {
+		s.hc.RegisterService(ComponentPostgres, hc.NewService(cfg.Postgres.PingInterval, func() error {
+			return s.postgres.Load().PingDB()
+		}, nil))
+	}
+
+	if s.redis.Load() != nil {
+		s.hc.RegisterService(ComponentRedis, hc.NewService(cfg.Redis.PingInterval, func() error {
+			return s.redis.Load().PingDB()
+		}, nil))
+	}
 
-	// Start HC Server
-	go s.hc.Start()
+	if s.rabbitService != nil {
+		s.hc.RegisterService(ComponentRabbit, hc.NewService(0, s.rabbitService.Ping, nil))
+	}
 }
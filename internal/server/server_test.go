@@ -1,20 +1,263 @@
 package server_test
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Harardin/rate-limit/internal/config"
+	"github.com/Harardin/rate-limit/internal/fairqueue"
+	"github.com/Harardin/rate-limit/internal/limiter"
 	"github.com/Harardin/rate-limit/internal/server"
+	"github.com/Harardin/rate-limit/internal/shedding"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/lifecycle"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Limiter(t *testing.T) {
-	srv, _ := server.New(nil, nil)
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+
+	srv, err := server.New(log.New(), nil, server.WithClock(c))
+	require.NoError(t, err)
+	defer srv.Close()
 
 	t.Run("loop request tests", func(t *testing.T) {
-		rr := httptest.NewRecorder()
-		req := httptest.NewRequest("POST", "localhost:20001/req", nil)
+		// default rules allow 1 request per second for a client ip
+		codes := make(map[int]int)
 		for i := 0; i < 100; i++ {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "localhost:20001/req", nil)
 			srv.HandleRequest(rr, req)
+			codes[rr.Code]++
+
+			if rr.Code == http.StatusTooManyRequests {
+				assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+			}
+		}
+
+		assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusTooManyRequests: 99}, codes)
+
+		c.Advance(time.Second)
+
+		rr := httptest.NewRecorder()
+		srv.HandleRequest(rr, httptest.NewRequest("POST", "localhost:20001/req", nil))
+		assert.Equal(t, http.StatusOK, rr.Code, "next window")
+	})
+}
+
+type plansMock map[string]limiter.Plan
+
+func (m plansMock) ResolvePlan(apiKey string) (limiter.Plan, bool) {
+	p, ok := m[apiKey]
+	return p, ok
+}
+
+// blockingWriter blocks the response until release is closed, so the request holds its slot
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	close(w.started)
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+// holdRequest serves a request until the returned func is called
+func holdRequest(t *testing.T, h http.Handler, r *http.Request) func() {
+	w := &blockingWriter{ResponseRecorder: httptest.NewRecorder(), started: make(chan struct{}), release: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	select {
+	case <-w.started:
+	case <-done:
+		require.Fail(t, "request is not held", "status %d", w.Code)
+	}
+
+	return func() {
+		close(w.release)
+		<-done
+	}
+}
+
+func check(h http.Handler, ctx context.Context, apiKey string) int {
+	body := fmt.Sprintf(`{"key": "client", "api_key": "%s", "route": "/v1/check"}`, apiKey)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/check", strings.NewReader(body)).WithContext(ctx))
+
+	return rr.Code
+}
+
+func TestCheckTenant(t *testing.T) {
+	plans := plansMock{"free-key": {Name: "free", Tenant: "free", Priority: "low"}}
+
+	newServer := func(t *testing.T, cfg config.Config) http.Handler {
+		var current atomic.Pointer[config.Config]
+		current.Store(&cfg)
+
+		srv, err := server.New(log.New(log.WithLogLevel(log.ERROR)), &current, server.WithPlans(plans))
+		require.NoError(t, err)
+		t.Cleanup(srv.Close)
+
+		return srv.Handler()
+	}
+
+	t.Run("shedding resolves the plan by the body api key", func(t *testing.T) {
+		var cfg config.Config
+		cfg.Shedding = shedding.Config{Enabled: true, MaxInflight: 1}
+		h := newServer(t, cfg)
+
+		release := holdRequest(t, h, httptest.NewRequest("POST", "/req", nil))
+		defer release()
+
+		assert.Equal(t, http.StatusServiceUnavailable, check(h, context.Background(), "free-key"), "low priority plan is shed")
+		assert.Equal(t, http.StatusOK, check(h, context.Background(), ""))
+	})
+
+	t.Run("fair queue resolves the tenant by the body api key", func(t *testing.T) {
+		var cfg config.Config
+		cfg.FairQueue = fairqueue.Config{Enabled: true, Capacity: 1, MaxQueue: 1, Timeout: 60000}
+		h := newServer(t, cfg)
+
+		release := holdRequest(t, h, httptest.NewRequest("POST", "/req", nil))
+		defer release()
+
+		// an anonymous request waits in the queue
+		ctx, cancel := context.WithCancel(context.Background())
+		queued := make(chan struct{})
+		go func() {
+			check(h, ctx, "")
+			close(queued)
+		}()
+		defer func() {
+			cancel()
+			<-queued
+		}()
+
+		// requests with a done context leave the queue at once
+		done, cancelDone := context.WithCancel(context.Background())
+		cancelDone()
+
+		require.Eventually(t, func() bool {
+			return check(h, done, "") == http.StatusServiceUnavailable
+		}, time.Second, time.Millisecond, "anonymous queue is full")
+
+		assert.NotEqual(t, http.StatusServiceUnavailable, check(h, done, "free-key"), "the tenant has its own queue")
+	})
+}
+
+func TestRestartPortTaken(t *testing.T) {
+	// listen return a busy listener on a free port
+	listen := func(t *testing.T) (net.Listener, string) {
+		ln, err := net.Listen("tcp", ":0")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			ln.Close()
+		})
+
+		return ln, fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+	}
+	freePort := func(t *testing.T) string {
+		ln, port := listen(t)
+		ln.Close()
+		return port
+	}
+
+	var cfg config.Config
+	cfg.ServiceName = "rate-limit"
+	cfg.HTTP.Addr = "127.0.0.1:" + freePort(t)
+	cfg.Prometheus.Port = freePort(t)
+	cfg.HealthCheck.Port = freePort(t)
+
+	var current atomic.Pointer[config.Config]
+	current.Store(&cfg)
+
+	logger := log.New(log.WithLogLevel(log.ERROR))
+	srv, err := server.New(logger, &current)
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	m := lifecycle.New(logger)
+	require.NoError(t, srv.Register(m))
+	require.NoError(t, m.Start(context.Background()))
+	defer m.Stop()
+
+	httpLn, httpPort := listen(t)
+	metricsLn, metricsPort := listen(t)
+	hcLn, hcPort := listen(t)
+
+	next := cfg
+	next.HTTP.Addr = "127.0.0.1:" + httpPort
+	next.Prometheus.Port = metricsPort
+	next.HealthCheck.Port = hcPort
+	current.Store(&next)
+
+	for _, env := range []string{"PROMETHEUS_PORT", "HTTP_ADDR", "HEALTH_CHECK_PORT"} {
+		_, err := m.Restart(context.Background(), []string{env})
+		assert.Error(t, err, env)
+	}
+
+	select {
+	case err := <-m.Errors():
+		require.Fail(t, "failed restart is reported as a component failure", err.Error())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	httpLn.Close()
+	metricsLn.Close()
+	hcLn.Close()
+
+	started, err := m.Resume(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{server.ComponentMetrics, server.ComponentHTTP, server.ComponentHC}, started)
+
+	for _, url := range []string{
+		"http://127.0.0.1:" + metricsPort + "/metrics",
+		"http://127.0.0.1:" + hcPort + "/hc",
+		"http://127.0.0.1:" + httpPort + "/v1/check",
+	} {
+		res, err := http.Post(url, "application/json", strings.NewReader(`{"key": "client"}`))
+		require.NoError(t, err, url)
+		res.Body.Close()
+		assert.NotEqual(t, http.StatusNotFound, res.StatusCode, url)
+	}
+}
+
+func BenchmarkHandleCheck(b *testing.B) {
+	srv, err := server.New(log.New(log.WithLogLevel(log.ERROR)), nil)
+	require.NoError(b, err)
+	defer srv.Close()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			body := fmt.Sprintf(`{"key": "key-%d", "route": "/bench"}`, i%1000)
+			i++
+
+			rr := httptest.NewRecorder()
+			srv.HandleCheck(rr, httptest.NewRequest("POST", "/v1/check", strings.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				b.Errorf("unexpected status %d", rr.Code)
+				return
+			}
 		}
 	})
 }
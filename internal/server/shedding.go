@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+)
+
+// shed rejects requests with 503 under overload, lower priority classes are rejected first.
+// Admin handlers are not wrapped, so they keep capacity under any load.
+func (s *Server) shed(next http.HandlerFunc) http.HandlerFunc {
+	if s.shedder == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		priority := s.classifier.Classify(r, requestAPIKey(r))
+
+		done, ok := s.shedder.Admit(priority)
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		defer done()
+
+		next(w, r)
+	}
+}
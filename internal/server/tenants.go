@@ -0,0 +1,264 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Harardin/rate-limit/internal/tenant"
+
+	"github.com/goccy/go-json"
+)
+
+// tenantsOnly responds 404 if tenants are disabled
+func (s *Server) tenantsOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.tenants == nil {
+			http.Error(w, "Tenants are disabled", http.StatusNotFound)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) HandleListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := s.tenants.Repository().ListPlans(r.Context())
+	if err != nil {
+		s.adminError(w, "failed to list plans", err)
+		return
+	}
+
+	s.writeJSON(w, plans)
+}
+
+func (s *Server) HandleGetPlan(w http.ResponseWriter, r *http.Request) {
+	p, err := s.tenants.Repository().GetPlan(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.tenantError(w, "failed to get plan", err)
+		return
+	}
+
+	s.writeJSON(w, p)
+}
+
+// HandleSavePlan creates or replaces the plan, new limits are applied on all instances
+func (s *Server) HandleSavePlan(w http.ResponseWriter, r *http.Request) {
+	var p tenant.Plan
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+	p.ID = r.PathValue("id")
+
+	if err := p.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.tenants.Repository().SavePlan(r.Context(), p); err != nil {
+		s.adminError(w, "failed to save plan", err)
+		return
+	}
+
+	s.logger.Infof("plan \"%s\" is saved", p.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeletePlan removes the plan, plans used by tenants can't be removed
+func (s *Server) HandleDeletePlan(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.tenants.Repository().DeletePlan(r.Context(), id); err != nil {
+		s.tenantError(w, "failed to delete plan", err)
+		return
+	}
+
+	s.logger.Infof("plan \"%s\" is deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) HandleListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := s.tenants.Repository().ListTenants(r.Context())
+	if err != nil {
+		s.adminError(w, "failed to list tenants", err)
+		return
+	}
+
+	s.writeJSON(w, tenants)
+}
+
+func (s *Server) HandleGetTenant(w http.ResponseWriter, r *http.Request) {
+	id, ok := tenantID(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := s.tenants.Repository().GetTenant(r.Context(), id)
+	if err != nil {
+		s.tenantError(w, "failed to get tenant", err)
+		return
+	}
+
+	s.writeJSON(w, t)
+}
+
+func (s *Server) HandleCreateTenant(w http.ResponseWriter, r *http.Request) {
+	t, ok := decodeTenant(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := s.tenants.Repository().CreateTenant(r.Context(), t)
+	if err != nil {
+		s.tenantError(w, "failed to create tenant", err)
+		return
+	}
+
+	s.logger.Infof("tenant %d is created with plan \"%s\"", t.ID, t.PlanID)
+
+	w.WriteHeader(http.StatusCreated)
+	s.writeJSON(w, t)
+}
+
+// HandleUpdateTenant replaces name, plan, custom limits and time zone of the tenant
+func (s *Server) HandleUpdateTenant(w http.ResponseWriter, r *http.Request) {
+	id, ok := tenantID(w, r)
+	if !ok {
+		return
+	}
+
+	t, ok := decodeTenant(w, r)
+	if !ok {
+		return
+	}
+	t.ID = id
+
+	t, err := s.tenants.Repository().UpdateTenant(r.Context(), t)
+	if err != nil {
+		s.tenantError(w, "failed to update tenant", err)
+		return
+	}
+
+	s.logger.Infof("tenant %d is updated", t.ID)
+
+	s.writeJSON(w, t)
+}
+
+// HandleDeleteTenant removes the tenant with all its api keys
+func (s *Server) HandleDeleteTenant(w http.ResponseWriter, r *http.Request) {
+	id, ok := tenantID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.tenants.Repository().DeleteTenant(r.Context(), id); err != nil {
+		s.tenantError(w, "failed to delete tenant", err)
+		return
+	}
+
+	s.logger.Infof("tenant %d is deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id, ok := tenantID(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := s.tenants.Repository().ListAPIKeys(r.Context(), id)
+	if err != nil {
+		s.adminError(w, "failed to list api keys", err)
+		return
+	}
+
+	s.writeJSON(w, keys)
+}
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// HandleCreateAPIKey return a new api key of the tenant. The key is returned only once
+func (s *Server) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := tenantID(w, r)
+	if !ok {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	k, err := s.tenants.Repository().CreateAPIKey(r.Context(), id, req.Name)
+	if err != nil {
+		s.tenantError(w, "failed to create api key", err)
+		return
+	}
+
+	s.logger.Infof("api key \"%s\" of tenant %d is created", k.Hash, id)
+
+	w.WriteHeader(http.StatusCreated)
+	s.writeJSON(w, k)
+}
+
+// HandleRevokeAPIKey revokes the api key by its hash
+func (s *Server) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := tenantID(w, r)
+	if !ok {
+		return
+	}
+
+	hash := r.PathValue("hash")
+	if err := s.tenants.Repository().RevokeAPIKey(r.Context(), id, hash); err != nil {
+		s.tenantError(w, "failed to revoke api key", err)
+		return
+	}
+
+	s.logger.Infof("api key \"%s\" of tenant %d is revoked", hash, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tenantID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad request: bad tenant id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func decodeTenant(w http.ResponseWriter, r *http.Request) (tenant.Tenant, bool) {
+	var t tenant.Tenant
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return t, false
+	}
+
+	if err := t.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return t, false
+	}
+
+	return t, true
+}
+
+// tenantError maps repository errors to responses
+func (s *Server) tenantError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, tenant.ErrConflict):
+		http.Error(w, "Conflict: the plan doesn't exist or is used by tenants", http.StatusConflict)
+	default:
+		s.adminError(w, msg, err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package shedding
+
+import "time"
+
+// cpuTime is not supported, cpu signal is always 0
+func cpuTime() time.Duration {
+	return 0
+}
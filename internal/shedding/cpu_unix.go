@@ -0,0 +1,18 @@
+//go:build unix
+
+package shedding
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime return user and system cpu time of the process
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
@@ -0,0 +1,122 @@
+package shedding
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	// PriorityCritical is never shed, e.g. health checks and admin calls
+	PriorityCritical
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:      "low",
+	PriorityNormal:   "normal",
+	PriorityHigh:     "high",
+	PriorityCritical: "critical",
+}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+
+	return PriorityNormal, fmt.Errorf("unknown priority \"%s\"", s)
+}
+
+type routePriority struct {
+	route    string
+	priority Priority
+}
+
+// parseRoutePriorities parse list of "route=priority"
+func parseRoutePriorities(values []string) ([]routePriority, error) {
+	res := make([]routePriority, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		route, name, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad route priority \"%s\", expected route=priority", v)
+		}
+
+		p, err := ParsePriority(name)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, routePriority{route: route, priority: p})
+	}
+
+	return res, nil
+}
+
+// Classifier resolves request priority: route rule, then tenant plan, then header. Default priority is normal.
+type Classifier struct {
+	header string
+	routes []routePriority
+	plans  limiter.PlanResolver
+}
+
+// NewClassifier return classifier, plans may be nil if tenants are disabled
+func NewClassifier(cfg Config, plans limiter.PlanResolver) (*Classifier, error) {
+	routes, err := parseRoutePriorities(cfg.RoutePriorities)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Classifier{
+		header: cfg.PriorityHeader,
+		routes: routes,
+		plans:  plans,
+	}, nil
+}
+
+// Classify return priority of the request. The api key is resolved by the caller, it may be sent in the body
+func (c *Classifier) Classify(r *http.Request, apiKey string) Priority {
+	// the longest matching route wins
+	matched := -1
+	for i, rp := range c.routes {
+		if strings.HasPrefix(r.URL.Path, rp.route) && (matched < 0 || len(rp.route) > len(c.routes[matched].route)) {
+			matched = i
+		}
+	}
+	if matched >= 0 {
+		return c.routes[matched].priority
+	}
+
+	if c.plans != nil && apiKey != "" {
+		if plan, ok := c.plans.ResolvePlan(apiKey); ok && plan.Priority != "" {
+			if p, err := ParsePriority(plan.Priority); err == nil {
+				return p
+			}
+		}
+	}
+
+	if c.header != "" {
+		// clients can't claim critical priority
+		if p, err := ParsePriority(r.Header.Get(c.header)); err == nil && p < PriorityCritical {
+			return p
+		}
+	}
+
+	return PriorityNormal
+}
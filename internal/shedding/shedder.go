@@ -0,0 +1,172 @@
+package shedding
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	Enabled bool `json:"SHED_ENABLED"`
+	// MaxInflight - requests in flight, 0 - disabled. Default 1000
+	MaxInflight int64 `json:"SHED_MAX_INFLIGHT" default:"1000"`
+	// MaxCPU - share of cpu time of all cores used by the process, 0 - disabled. Default 0.9
+	MaxCPU float64 `json:"SHED_MAX_CPU" default:"0.9"`
+	// MaxLatency - average request latency. In milliseconds, 0 - disabled
+	MaxLatency int `json:"SHED_MAX_LATENCY"`
+	// PriorityHeader - request header with priority low, normal or high. Default X-Priority
+	PriorityHeader string `json:"SHED_PRIORITY_HEADER" default:"X-Priority"`
+	// RoutePriorities - list of route prefix and priority, e.g. "/v1/check=high,/req=low"
+	RoutePriorities []string `json:"SHED_ROUTE_PRIORITIES"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if err := validation.ValidateStruct(
+		c,
+		validation.Field(&c.MaxInflight, validation.Min(int64(0))),
+		validation.Field(&c.MaxCPU, validation.Min(0.0), validation.Max(1.0)),
+		validation.Field(&c.MaxLatency, validation.Min(0)),
+	); err != nil {
+		return err
+	}
+
+	_, err := parseRoutePriorities(c.RoutePriorities)
+	return err
+}
+
+// shedLoad is the load at which requests of the priority are rejected.
+// Load 1 means one of the signals reached its threshold.
+var shedLoad = map[Priority]float64{
+	PriorityLow:    1,
+	PriorityNormal: 1.2,
+	PriorityHigh:   1.5,
+}
+
+// latencySmoothing - weight of a new sample in the average latency
+const latencySmoothing = 0.1
+
+// Shedder rejects lower priority requests first when in flight requests, cpu usage or latency cross thresholds.
+//
+// Critical requests are always admitted and are not counted, so they keep capacity under any load.
+type Shedder struct {
+	maxInflight int64
+	maxCPU      float64
+	maxLatency  time.Duration
+	clock       clock.Clock
+
+	inflight atomic.Int64
+	// cpu usage is stored as float64 bits
+	cpu atomic.Uint64
+
+	mu      sync.Mutex
+	latency float64
+}
+
+func NewShedder(cfg Config, opts ...Option) *Shedder {
+	options := Options{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Shedder{
+		maxInflight: cfg.MaxInflight,
+		maxCPU:      cfg.MaxCPU,
+		maxLatency:  time.Duration(cfg.MaxLatency) * time.Millisecond,
+		clock:       options.Clock,
+	}
+}
+
+// Start samples cpu usage every second until ctx is done.
+//
+// Average latency decays every second, so the shedder recovers when all requests are shed and there are no new samples.
+func (s *Shedder) Start(ctx context.Context) {
+	ticker := s.clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	prevCPU, prevTime := cpuTime(), s.clock.Now()
+	for {
+		select {
+		case now := <-ticker.C():
+			cpu := cpuTime()
+			usage := float64(cpu-prevCPU) / float64(now.Sub(prevTime)) / float64(runtime.NumCPU())
+			s.cpu.Store(math.Float64bits(usage))
+
+			prevCPU, prevTime = cpu, now
+
+			s.mu.Lock()
+			s.latency *= 1 - latencySmoothing
+			s.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Admit return done func if the request is admitted. Done must be called when the request is finished
+func (s *Shedder) Admit(p Priority) (func(), bool) {
+	if p >= PriorityCritical {
+		return func() {}, true
+	}
+
+	if s.Load() >= shedLoad[p] {
+		return nil, false
+	}
+
+	s.inflight.Add(1)
+	start := s.clock.Now()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.inflight.Add(-1)
+			s.ObserveLatency(s.clock.Since(start))
+		})
+	}, true
+}
+
+// ObserveLatency adds the sample to the average latency
+func (s *Shedder) ObserveLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latency == 0 {
+		s.latency = float64(d)
+		return
+	}
+
+	s.latency += (float64(d) - s.latency) * latencySmoothing
+}
+
+// Load return the highest ratio of a signal to its threshold
+func (s *Shedder) Load() float64 {
+	var load float64
+
+	if s.maxInflight > 0 {
+		load = max(load, float64(s.inflight.Load())/float64(s.maxInflight))
+	}
+
+	if s.maxCPU > 0 {
+		load = max(load, math.Float64frombits(s.cpu.Load())/s.maxCPU)
+	}
+
+	if s.maxLatency > 0 {
+		s.mu.Lock()
+		latency := s.latency
+		s.mu.Unlock()
+
+		load = max(load, latency/float64(s.maxLatency))
+	}
+
+	return load
+}
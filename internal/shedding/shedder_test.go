@@ -0,0 +1,102 @@
+package shedding_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/internal/shedding"
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type plansMock map[string]limiter.Plan
+
+func (m plansMock) ResolvePlan(apiKey string) (limiter.Plan, bool) {
+	p, ok := m[apiKey]
+	return p, ok
+}
+
+func TestClassify(t *testing.T) {
+	c, err := shedding.NewClassifier(shedding.Config{
+		PriorityHeader:  "X-Priority",
+		RoutePriorities: []string{"/v1=low", "/v1/check=high"},
+	}, plansMock{"premium": {Priority: "high"}})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		apiKey   string
+		headers  map[string]string
+		priority shedding.Priority
+	}{
+		{name: "default", path: "/req", priority: shedding.PriorityNormal},
+		{name: "longest route wins", path: "/v1/check", priority: shedding.PriorityHigh},
+		{name: "route", path: "/v1/other", priority: shedding.PriorityLow},
+		{name: "plan", path: "/req", apiKey: "premium", headers: map[string]string{"X-Priority": "low"}, priority: shedding.PriorityHigh},
+		{name: "header", path: "/req", headers: map[string]string{"X-Priority": "low"}, priority: shedding.PriorityLow},
+		{name: "client can't claim critical", path: "/req", headers: map[string]string{"X-Priority": "critical"}, priority: shedding.PriorityNormal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tc.path, nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+
+			assert.Equal(t, tc.priority, c.Classify(r, tc.apiKey))
+		})
+	}
+
+	_, err = shedding.NewClassifier(shedding.Config{RoutePriorities: []string{"/v1"}}, nil)
+	require.Error(t, err)
+}
+
+func TestShedder(t *testing.T) {
+	s := shedding.NewShedder(shedding.Config{MaxInflight: 10})
+
+	admitted := make([]func(), 0)
+	admit := func(p shedding.Priority) bool {
+		done, ok := s.Admit(p)
+		if ok {
+			admitted = append(admitted, done)
+		}
+		return ok
+	}
+
+	for i := 0; i < 10; i++ {
+		require.True(t, admit(shedding.PriorityNormal))
+	}
+
+	assert.False(t, admit(shedding.PriorityLow), "low priority is shed first")
+	assert.True(t, admit(shedding.PriorityNormal))
+	assert.True(t, admit(shedding.PriorityNormal))
+	assert.False(t, admit(shedding.PriorityNormal))
+	assert.True(t, admit(shedding.PriorityHigh))
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, admit(shedding.PriorityCritical), "critical is never shed")
+	}
+
+	for _, done := range admitted {
+		done()
+	}
+	assert.True(t, admit(shedding.PriorityLow))
+}
+
+func TestShedderLatency(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	s := shedding.NewShedder(shedding.Config{MaxLatency: 100}, shedding.WithClock(c))
+
+	done, ok := s.Admit(shedding.PriorityNormal)
+	require.True(t, ok)
+
+	c.Advance(time.Second)
+	done()
+
+	_, ok = s.Admit(shedding.PriorityHigh)
+	assert.False(t, ok, "average latency is over the threshold")
+}
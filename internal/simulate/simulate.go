@@ -0,0 +1,146 @@
+package simulate
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+// Result - decisions of the rule for the key
+type Result struct {
+	Key  string `json:"key"`
+	Rule string `json:"rule"`
+	// Allowed - requests allowed while the rule matched
+	Allowed int64 `json:"allowed"`
+	// Rejected - requests rejected by the rule
+	Rejected int64 `json:"rejected"`
+	// ShadowRejected - requests the shadow rule would reject
+	ShadowRejected int64 `json:"shadow_rejected"`
+}
+
+// Report of the simulation
+type Report struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Requests int64     `json:"requests"`
+	Allowed  int64     `json:"allowed"`
+	Rejected int64     `json:"rejected"`
+	// Results sorted by key and rule
+	Results []Result `json:"results"`
+}
+
+// Run replays records against the rules with a virtual clock, so hours of traffic are replayed in seconds
+func Run(ctx context.Context, logger log.Logger, rules []limiter.Rule, records []Record) (Report, error) {
+	var report Report
+	if len(records) == 0 {
+		return report, nil
+	}
+
+	start := records[0].Time
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	// virtual time is moved by trace records
+	c := clock.NewFake(start)
+
+	store := limiter.NewMemoryStore(time.Hour, limiter.WithStoreClock(c))
+	defer store.Close()
+
+	l := limiter.New(logger, store, rules, limiter.WithClock(c))
+
+	type resultKey struct{ key, rule string }
+	results := make(map[resultKey]*Result)
+	result := func(key, rule string) *Result {
+		k := resultKey{key, rule}
+		r, ok := results[k]
+		if !ok {
+			r = &Result{Key: key, Rule: rule}
+			results[k] = r
+		}
+		return r
+	}
+
+	report.Start = start
+	for _, rec := range records {
+		if !rec.Time.IsZero() {
+			c.Set(rec.Time)
+		}
+
+		d, err := l.Check(ctx, limiter.Request{
+			Key:    rec.Key,
+			APIKey: rec.APIKey,
+			Route:  rec.Route,
+			Cost:   rec.Cost,
+			Attrs:  rec.Attrs,
+		})
+		if err != nil {
+			return report, err
+		}
+
+		report.Requests++
+		if d.Allowed {
+			report.Allowed++
+		} else {
+			report.Rejected++
+		}
+
+		for _, rule := range rules {
+			if rule.Mode != limiter.ModeEnforce || !rule.Match(rec.Route) {
+				continue
+			}
+
+			key := ruleKey(rule, rec)
+			if key == "" {
+				continue
+			}
+
+			switch {
+			case d.Allowed:
+				result(key, rule.Name).Allowed++
+			case d.Rule == rule.Name:
+				result(key, rule.Name).Rejected++
+			}
+		}
+
+		for _, name := range d.Shadow {
+			for _, rule := range rules {
+				if rule.Name == name {
+					result(ruleKey(rule, rec), name).ShadowRejected++
+				}
+			}
+		}
+	}
+	report.End = c.Now()
+
+	report.Results = make([]Result, 0, len(results))
+	for _, r := range results {
+		report.Results = append(report.Results, *r)
+	}
+
+	sort.Slice(report.Results, func(i, j int) bool {
+		a, b := report.Results[i], report.Results[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Rule < b.Rule
+	})
+
+	return report, nil
+}
+
+// ruleKey return the rate limit key of the rule, see limiter.Rule.KeyBy
+func ruleKey(rule limiter.Rule, rec Record) string {
+	switch rule.KeyBy {
+	case "":
+		return rec.Key
+	case limiter.AttrAPIKey:
+		return rec.APIKey
+	default:
+		return rec.Attrs[rule.KeyBy]
+	}
+}
@@ -0,0 +1,71 @@
+package simulate_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/internal/simulate"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	rules, err := limiter.ParseRules(`[
+		{"name": "api", "route": "/api", "limit": 2, "window": "1m"},
+		{"name": "api-strict", "route": "/api", "limit": 1, "window": "1m", "mode": "shadow"}
+	]`)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name   string
+		format string
+		trace  string
+	}{
+		{
+			name:   "csv",
+			format: simulate.FormatCSV,
+			trace: `timestamp,key,route,cost
+2024-05-01T10:00:00Z,a,/api/users,1
+2024-05-01T10:00:10Z,a,/api/users,1
+2024-05-01T10:00:20Z,a,/api/users,1
+2024-05-01T10:01:05Z,a,/api/users,1
+2024-05-01T10:00:30Z,b,/api/users,
+2024-05-01T10:00:40Z,b,/health,1
+`,
+		},
+		{
+			name:   "jsonl",
+			format: simulate.FormatJSONL,
+			trace: `{"timestamp": 1714557600, "key": "a", "route": "/api/users"}
+{"timestamp": "2024-05-01T10:00:10Z", "key": "a", "route": "/api/users"}
+{"timestamp": 1714557620.5, "key": "a", "route": "/api/users"}
+{"timestamp": "2024-05-01T10:01:05Z", "key": "a", "route": "/api/users", "cost": 1}
+{"timestamp": "2024-05-01T10:00:30Z", "key": "b", "route": "/api/users"}
+{"key": "b", "route": "/health"}
+`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := simulate.ReadTrace(strings.NewReader(tc.trace), tc.format)
+			require.NoError(t, err)
+			require.Len(t, records, 6)
+
+			report, err := simulate.Run(context.Background(), log.New(), rules, records)
+			require.NoError(t, err)
+
+			assert.Equal(t, int64(6), report.Requests)
+			assert.Equal(t, int64(1), report.Rejected, "the third request of key a in the window")
+			assert.Equal(t, []simulate.Result{
+				{Key: "a", Rule: "api", Allowed: 3, Rejected: 1},
+				{Key: "a", Rule: "api-strict", ShadowRejected: 2},
+				{Key: "b", Rule: "api", Allowed: 1},
+			}, report.Results)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// Trace formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Record is a request of the traffic trace
+type Record struct {
+	// Time - zero time means the time of the previous record
+	Time   time.Time
+	Key    string
+	Route  string
+	APIKey string
+	Cost   int64
+	Attrs  map[string]string
+}
+
+type jsonRecord struct {
+	Timestamp json.RawMessage   `json:"timestamp"`
+	Time      json.RawMessage   `json:"time"`
+	Key       string            `json:"key"`
+	Route     string            `json:"route"`
+	APIKey    string            `json:"api_key"`
+	Cost      int64             `json:"cost"`
+	Attrs     map[string]string `json:"attrs"`
+}
+
+// ReadTrace reads records from CSV with header (timestamp, key, route, cost, api_key) or JSON lines.
+// Timestamp is RFC3339 or unix time in seconds. Records are sorted by time
+func ReadTrace(r io.Reader, format string) ([]Record, error) {
+	var (
+		res []Record
+		err error
+	)
+
+	switch format {
+	case FormatCSV:
+		res, err = readCSV(r)
+	case FormatJSONL:
+		res, err = readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown trace format \"%s\"", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// records without time happen at the time of the previous record
+	for i := range res {
+		if res[i].Time.IsZero() && i > 0 {
+			res[i].Time = res[i-1].Time
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Time.Before(res[j].Time)
+	})
+
+	return res, nil
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["key"]; !ok {
+		return nil, errors.New("csv column \"key\" is required")
+	}
+
+	get := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var res []Record
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec := Record{
+			Key:    get(row, "key"),
+			Route:  get(row, "route"),
+			APIKey: get(row, "api_key"),
+		}
+
+		ts := get(row, "timestamp")
+		if ts == "" {
+			ts = get(row, "time")
+		}
+
+		if rec.Time, err = parseTime(ts); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if cost := get(row, "cost"); cost != "" {
+			if rec.Cost, err = strconv.ParseInt(cost, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: bad cost \"%s\"", line, cost)
+			}
+		}
+
+		res = append(res, rec)
+	}
+}
+
+func readJSONL(r io.Reader) ([]Record, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var res []Record
+	for line := 1; sc.Scan(); line++ {
+		data := strings.TrimSpace(sc.Text())
+		if data == "" {
+			continue
+		}
+
+		var jr jsonRecord
+		if err := json.Unmarshal([]byte(data), &jr); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		ts := jr.Timestamp
+		if len(ts) == 0 {
+			ts = jr.Time
+		}
+
+		t, err := parseTime(strings.Trim(string(ts), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		res = append(res, Record{
+			Time:   t,
+			Key:    jr.Key,
+			Route:  jr.Route,
+			APIKey: jr.APIKey,
+			Cost:   jr.Cost,
+			Attrs:  jr.Attrs,
+		})
+	}
+
+	return res, sc.Err()
+}
+
+// parseTime parses RFC3339 or unix time in seconds, empty value is zero time
+func parseTime(v string) (time.Time, error) {
+	if v == "" || v == "null" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+
+	sec, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad timestamp \"%s\", expected RFC3339 or unix seconds", v)
+	}
+
+	whole, frac := math.Modf(sec)
+
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))).UTC(), nil
+}
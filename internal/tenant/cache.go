@@ -0,0 +1,141 @@
+package tenant
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+)
+
+// Cache keeps plans of all api keys in memory and reloads them on every change in postgres.
+//
+// Cache implements limiter.PlanResolver and limiter.TenantPlanResolver.
+type Cache struct {
+	logger log.Logger
+	clock  clock.Clock
+	// repo is replaced on reconnect to postgres
+	repo atomic.Pointer[Repository]
+
+	syncInterval time.Duration
+
+	plans atomic.Pointer[map[string]limiter.Plan]
+}
+
+func NewCache(logger log.Logger, db *postgres.PostgreSQL, cfg Config, opts ...Option) *Cache {
+	syncInterval := time.Duration(cfg.SyncInterval) * time.Second
+	if syncInterval == 0 {
+		syncInterval = time.Minute
+	}
+
+	c := &Cache{
+		logger:       logger,
+		clock:        clock.Real{},
+		syncInterval: syncInterval,
+	}
+	c.SetDB(db)
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// SetDB replaces the postgres connection of the cache, e.g. after reconnect
+func (c *Cache) SetDB(db *postgres.PostgreSQL) {
+	c.repo.Store(NewRepository(db))
+}
+
+// ResolvePlan return the plan of the tenant owning the api key
+func (c *Cache) ResolvePlan(apiKey string) (limiter.Plan, bool) {
+	plans := c.plans.Load()
+	if plans == nil {
+		return limiter.Plan{}, false
+	}
+
+	p, ok := (*plans)[HashAPIKey(apiKey)]
+
+	return p, ok
+}
+
+// ResolveTenantPlan return the plan of the tenant with at least one active api key. It is used by admin calls only,
+// so plans are searched without an index
+func (c *Cache) ResolveTenantPlan(tenant string) (limiter.Plan, bool) {
+	plans := c.plans.Load()
+	if plans == nil {
+		return limiter.Plan{}, false
+	}
+
+	for _, p := range *plans {
+		if p.Tenant == tenant {
+			return p, true
+		}
+	}
+
+	return limiter.Plan{}, false
+}
+
+// Repository return repository used by the cache
+func (c *Cache) Repository() *Repository {
+	return c.repo.Load()
+}
+
+// Start loads plans and keeps them in sync until ctx is done
+func (c *Cache) Start(ctx context.Context) {
+	if err := c.Sync(ctx); err != nil {
+		c.logger.Errorf("failed to load tenants: %v", err)
+	}
+
+	go c.listen(ctx)
+
+	ticker := c.clock.NewTicker(c.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := c.Sync(ctx); err != nil {
+				c.logger.Errorf("failed to sync tenants: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Cache) Sync(ctx context.Context) error {
+	plans, err := c.repo.Load().LoadPlans(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.plans.Store(&plans)
+
+	return nil
+}
+
+func (c *Cache) listen(ctx context.Context) {
+	for {
+		err := c.repo.Load().ListenChanges(ctx, func() {
+			if err := c.Sync(ctx); err != nil {
+				c.logger.Errorf("failed to sync tenants: %v", err)
+			}
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.logger.Errorf("tenants notifications are lost, reconnecting: %v", err)
+
+		select {
+		case <-c.clock.After(time.Second * 5):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
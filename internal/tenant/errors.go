@@ -0,0 +1,9 @@
+package tenant
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when the plan doesn't exist or the deleted plan is used by tenants
+	ErrConflict = errors.New("conflict")
+)
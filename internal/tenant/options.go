@@ -0,0 +1,12 @@
+package tenant
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(c *Cache)
+
+// WithClock - clock of syncs and reconnects of notifications. Default clock.Real
+func WithClock(v clock.Clock) Option {
+	return func(c *Cache) {
+		c.clock = v
+	}
+}
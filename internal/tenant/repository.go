@@ -0,0 +1,351 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// changesChannel is notified by triggers on plans, tenants and api_keys tables
+const changesChannel = "tenants_changed"
+
+type Repository struct {
+	db *postgres.PostgreSQL
+}
+
+func NewRepository(db *postgres.PostgreSQL) *Repository {
+	return &Repository{db: db}
+}
+
+// LoadPlans return resolved plans of all active api keys by api key hash
+func (r *Repository) LoadPlans(ctx context.Context) (map[string]limiter.Plan, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT k.key_hash, t.id, t.time_zone, p.id, p.limits, t.custom_limits, p.priority
+		FROM api_keys k
+		JOIN tenants t ON t.id = k.tenant_id
+		JOIN plans p ON p.id = t.plan_id
+		WHERE k.revoked_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select api keys: %v", err)
+	}
+	defer rows.Close()
+
+	res := make(map[string]limiter.Plan)
+	for rows.Next() {
+		var (
+			keyHash      string
+			tenantID     int64
+			timeZone     string
+			planID       string
+			limits       map[string]int64
+			customLimits map[string]int64
+			priority     string
+		)
+
+		if err := rows.Scan(&keyHash, &tenantID, &timeZone, &planID, &limits, &customLimits, &priority); err != nil {
+			return nil, err
+		}
+
+		merged := make(map[string]int64, len(limits)+len(customLimits))
+		for rule, limit := range limits {
+			merged[rule] = limit
+		}
+		for rule, limit := range customLimits {
+			merged[rule] = limit
+		}
+
+		res[keyHash] = limiter.Plan{
+			Tenant:   strconv.FormatInt(tenantID, 10),
+			Name:     planID,
+			Limits:   merged,
+			TimeZone: timeZone,
+			Priority: priority,
+		}
+	}
+
+	return res, rows.Err()
+}
+
+// AssignPlan changes the plan of the tenant. ErrConflict is returned if the plan doesn't exist
+func (r *Repository) AssignPlan(ctx context.Context, tenantID int64, planID string) error {
+	tag, err := r.db.Exec(ctx, `UPDATE tenants SET plan_id = $2, updated_at = now() WHERE id = $1`, tenantID, planID)
+	if isForeignKeyViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign plan: %v", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListPlans return all plans
+func (r *Repository) ListPlans(ctx context.Context) ([]Plan, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, name, limits, priority FROM plans ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select plans: %v", err)
+	}
+	defer rows.Close()
+
+	res := make([]Plan, 0)
+	for rows.Next() {
+		var p Plan
+		if err := rows.Scan(&p.ID, &p.Name, &p.Limits, &p.Priority); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+
+	return res, rows.Err()
+}
+
+// GetPlan return ErrNotFound if the plan doesn't exist
+func (r *Repository) GetPlan(ctx context.Context, id string) (Plan, error) {
+	var p Plan
+
+	err := r.db.QueryRow(ctx, `SELECT id, name, limits, priority FROM plans WHERE id = $1`, id).
+		Scan(&p.ID, &p.Name, &p.Limits, &p.Priority)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, ErrNotFound
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to select plan: %v", err)
+	}
+
+	return p, nil
+}
+
+// SavePlan creates or replaces the plan
+func (r *Repository) SavePlan(ctx context.Context, p Plan) error {
+	if p.Limits == nil {
+		p.Limits = map[string]int64{}
+	}
+	if p.Priority == "" {
+		p.Priority = "normal"
+	}
+
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO plans (id, name, limits, priority)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			limits = EXCLUDED.limits,
+			priority = EXCLUDED.priority,
+			updated_at = now()`,
+		p.ID, p.Name, p.Limits, p.Priority,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save plan: %v", err)
+	}
+
+	return nil
+}
+
+// DeletePlan return ErrConflict if the plan is used by tenants
+func (r *Repository) DeletePlan(ctx context.Context, id string) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM plans WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete plan: %v", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListTenants return all tenants
+func (r *Repository) ListTenants(ctx context.Context) ([]Tenant, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, name, plan_id, custom_limits, time_zone FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select tenants: %v", err)
+	}
+	defer rows.Close()
+
+	res := make([]Tenant, 0)
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Name, &t.PlanID, &t.CustomLimits, &t.TimeZone); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+
+	return res, rows.Err()
+}
+
+// GetTenant return ErrNotFound if the tenant doesn't exist
+func (r *Repository) GetTenant(ctx context.Context, id int64) (Tenant, error) {
+	var t Tenant
+
+	err := r.db.QueryRow(ctx, `SELECT id, name, plan_id, custom_limits, time_zone FROM tenants WHERE id = $1`, id).
+		Scan(&t.ID, &t.Name, &t.PlanID, &t.CustomLimits, &t.TimeZone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrNotFound
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to select tenant: %v", err)
+	}
+
+	return t, nil
+}
+
+// CreateTenant return the tenant with the new id. ErrConflict is returned if the plan doesn't exist
+func (r *Repository) CreateTenant(ctx context.Context, t Tenant) (Tenant, error) {
+	t = withTenantDefaults(t)
+
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO tenants (name, plan_id, custom_limits, time_zone)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		t.Name, t.PlanID, t.CustomLimits, t.TimeZone,
+	).Scan(&t.ID)
+	if isForeignKeyViolation(err) {
+		return t, ErrConflict
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to create tenant: %v", err)
+	}
+
+	return t, nil
+}
+
+// UpdateTenant replaces the tenant with t.ID. ErrConflict is returned if the plan doesn't exist
+func (r *Repository) UpdateTenant(ctx context.Context, t Tenant) (Tenant, error) {
+	t = withTenantDefaults(t)
+
+	tag, err := r.db.Exec(ctx, `
+		UPDATE tenants SET name = $2, plan_id = $3, custom_limits = $4, time_zone = $5, updated_at = now()
+		WHERE id = $1`,
+		t.ID, t.Name, t.PlanID, t.CustomLimits, t.TimeZone,
+	)
+	if isForeignKeyViolation(err) {
+		return t, ErrConflict
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to update tenant: %v", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return t, ErrNotFound
+	}
+
+	return t, nil
+}
+
+// DeleteTenant removes the tenant and its api keys
+func (r *Repository) DeleteTenant(ctx context.Context, id int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %v", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListAPIKeys return api keys of the tenant including revoked ones
+func (r *Repository) ListAPIKeys(ctx context.Context, tenantID int64) ([]APIKey, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT key_hash, tenant_id, name, created_at, revoked_at
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY created_at`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select api keys: %v", err)
+	}
+	defer rows.Close()
+
+	res := make([]APIKey, 0)
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.Hash, &k.TenantID, &k.Name, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, k)
+	}
+
+	return res, rows.Err()
+}
+
+// CreateAPIKey generates a new api key of the tenant. The returned key is not stored and can't be read again
+func (r *Repository) CreateAPIKey(ctx context.Context, tenantID int64, name string) (APIKey, error) {
+	key, err := NewAPIKey()
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	k := APIKey{Hash: HashAPIKey(key), Key: key, TenantID: tenantID, Name: name}
+
+	err = r.db.QueryRow(ctx, `
+		INSERT INTO api_keys (key_hash, tenant_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING created_at`,
+		k.Hash, k.TenantID, k.Name,
+	).Scan(&k.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return k, ErrNotFound
+	}
+	if err != nil {
+		return k, fmt.Errorf("failed to create api key: %v", err)
+	}
+
+	return k, nil
+}
+
+// RevokeAPIKey revokes the key of the tenant by its hash, requests with the key are no longer resolved to the tenant
+func (r *Repository) RevokeAPIKey(ctx context.Context, tenantID int64, hash string) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = now()
+		WHERE tenant_id = $1 AND key_hash = $2 AND revoked_at IS NULL`, tenantID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %v", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListenChanges calls fn on every change of plans, tenants or api keys until ctx is done or connection is lost
+func (r *Repository) ListenChanges(ctx context.Context, fn func()) error {
+	return r.db.Listen(ctx, changesChannel, func(string) {
+		fn()
+	})
+}
+
+func withTenantDefaults(t Tenant) Tenant {
+	if t.CustomLimits == nil {
+		t.CustomLimits = map[string]int64{}
+	}
+	if t.TimeZone == "" {
+		t.TimeZone = "UTC"
+	}
+
+	return t
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,111 @@
+package tenant
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	Enabled bool `json:"TENANTS_ENABLED"`
+	// Full reload of tenants, in addition to change notifications. In seconds. Default 60 seconds
+	SyncInterval int `json:"TENANTS_SYNC_INTERVAL" default:"60"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.SyncInterval, validation.Required, validation.Min(1)),
+	)
+}
+
+type Plan struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Limits by rule name
+	Limits map[string]int64 `json:"limits"`
+	// Priority of requests under overload - low, normal or high. Default normal
+	Priority string `json:"priority"`
+}
+
+func (p *Plan) Validate() error {
+	return validation.ValidateStruct(
+		p,
+		validation.Field(&p.ID, validation.Required),
+		validation.Field(&p.Name, validation.Required),
+		validation.Field(&p.Limits, validation.By(validateLimits)),
+		validation.Field(&p.Priority, validation.In("low", "normal", "high")),
+	)
+}
+
+type Tenant struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	PlanID string `json:"plan_id"`
+	// CustomLimits by rule name, have priority over plan limits
+	CustomLimits map[string]int64 `json:"custom_limits"`
+	// TimeZone - IANA time zone of calendar quotas. Default UTC
+	TimeZone string `json:"time_zone"`
+}
+
+func (t *Tenant) Validate() error {
+	return validation.ValidateStruct(
+		t,
+		validation.Field(&t.Name, validation.Required),
+		validation.Field(&t.PlanID, validation.Required),
+		validation.Field(&t.CustomLimits, validation.By(validateLimits)),
+		validation.Field(&t.TimeZone, validation.By(validateTimeZone)),
+	)
+}
+
+// APIKey of a tenant. The key itself is returned only once on creation, only its hash is stored
+type APIKey struct {
+	Hash      string     `json:"hash"`
+	Key       string     `json:"key,omitempty"`
+	TenantID  int64      `json:"tenant_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func validateLimits(v any) error {
+	for rule, limit := range v.(map[string]int64) {
+		if rule == "" || limit < 1 {
+			return validation.NewError("validation_limits", "must be positive limits by rule name")
+		}
+	}
+
+	return nil
+}
+
+// validateTimeZone rejects unknown zones, the limiter would silently use the rule time zone for them
+func validateTimeZone(v any) error {
+	if _, err := time.LoadLocation(v.(string)); err != nil {
+		return validation.NewError("validation_time_zone", "must be an IANA time zone, e.g. Europe/Berlin")
+	}
+
+	return nil
+}
+
+// HashAPIKey return the hash api keys are stored by
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey return a random api key
+func NewAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,49 @@
+package tenant_test
+
+import (
+	"testing"
+
+	"github.com/Harardin/rate-limit/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name  string
+		value interface{ Validate() error }
+		valid bool
+	}{
+		{name: "plan", value: &tenant.Plan{ID: "pro", Name: "Pro", Limits: map[string]int64{"api": 100}}, valid: true},
+		{name: "plan without id", value: &tenant.Plan{Name: "Pro"}},
+		{name: "plan with zero limit", value: &tenant.Plan{ID: "pro", Name: "Pro", Limits: map[string]int64{"api": 0}}},
+		{name: "plan with unknown priority", value: &tenant.Plan{ID: "pro", Name: "Pro", Priority: "urgent"}},
+		{name: "tenant", value: &tenant.Tenant{Name: "acme", PlanID: "pro"}, valid: true},
+		{name: "tenant without plan", value: &tenant.Tenant{Name: "acme"}},
+		{name: "tenant time zone", value: &tenant.Tenant{Name: "acme", PlanID: "pro", TimeZone: "Asia/Tokyo"}, valid: true},
+		{name: "tenant with unknown time zone", value: &tenant.Tenant{Name: "acme", PlanID: "pro", TimeZone: "Mars/Olympus"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.value.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	a, err := tenant.NewAPIKey()
+	require.NoError(t, err)
+
+	b, err := tenant.NewAPIKey()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a, b)
+	assert.Len(t, tenant.HashAPIKey(a), 64)
+}
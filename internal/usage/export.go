@@ -0,0 +1,55 @@
+package usage
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Export formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// WriteCSV writes rows with a header, only group by columns and counters are written
+func WriteCSV(w io.Writer, groupBy []string, rows []Row) error {
+	cw := csv.NewWriter(w)
+
+	header := append(append([]string{}, groupBy...), "allowed", "rejected", "cost", "rejected_cost")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := make([]string, 0, len(header))
+		for _, column := range groupBy {
+			switch column {
+			case GroupByBucket:
+				record = append(record, row.Bucket.UTC().Format(time.RFC3339))
+			case GroupByTenant:
+				record = append(record, row.Tenant)
+			case GroupByKey:
+				record = append(record, row.Key)
+			case GroupByRoute:
+				record = append(record, row.Route)
+			}
+		}
+
+		record = append(record,
+			strconv.FormatInt(row.Allowed, 10),
+			strconv.FormatInt(row.Rejected, 10),
+			strconv.FormatInt(row.Cost, 10),
+			strconv.FormatInt(row.RejectedCost, 10),
+		)
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
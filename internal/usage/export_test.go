@@ -0,0 +1,32 @@
+package usage_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/usage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSV(t *testing.T) {
+	rows := []usage.Row{
+		{Bucket: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Route: "/a", Allowed: 3, Rejected: 1, Cost: 6, RejectedCost: 2},
+		{Bucket: time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC), Route: "/b,c", Allowed: 1, Cost: 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, usage.WriteCSV(&buf, []string{usage.GroupByBucket, usage.GroupByRoute}, rows))
+
+	assert.Equal(t, "bucket,route,allowed,rejected,cost,rejected_cost\n"+
+		"2024-05-01T10:00:00Z,/a,3,1,6,2\n"+
+		"2024-05-01T11:00:00Z,\"/b,c\",1,0,1,0\n", buf.String())
+
+	t.Run("totals", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, usage.WriteCSV(&buf, nil, []usage.Row{{Allowed: 4, Rejected: 1, Cost: 7, RejectedCost: 2}}))
+		assert.Equal(t, "allowed,rejected,cost,rejected_cost\n4,1,7,2\n", buf.String())
+	})
+}
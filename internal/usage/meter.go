@@ -0,0 +1,185 @@
+package usage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+	"github.com/Harardin/rate-limit/pkg/postgres"
+)
+
+// bucketStore adds aggregated usage to the storage, Repository in the service
+type bucketStore interface {
+	Add(ctx context.Context, buckets map[bucketKey]counters) error
+}
+
+// Meter aggregates usage of checked requests into time buckets in memory
+// and periodically adds them to postgres.
+//
+// Meter implements limiter.UsageRecorder.
+type Meter struct {
+	logger log.Logger
+	clock  clock.Clock
+	// repo is replaced on reconnect to postgres
+	repo atomic.Pointer[Repository]
+	// store replaces the repository, e.g. in tests
+	store bucketStore
+
+	bucket        time.Duration
+	flushInterval time.Duration
+	maxBuckets    int
+
+	mu      sync.Mutex
+	buckets map[bucketKey]counters
+	// dropped - requests which didn't fit into maxBuckets since the last flush
+	dropped int64
+}
+
+func NewMeter(logger log.Logger, db *postgres.PostgreSQL, cfg Config, opts ...Option) *Meter {
+	bucket := time.Duration(cfg.Bucket) * time.Second
+	if bucket == 0 {
+		bucket = time.Hour
+	}
+
+	flushInterval := time.Duration(cfg.FlushInterval) * time.Second
+	if flushInterval == 0 {
+		flushInterval = 10 * time.Second
+	}
+
+	maxBuckets := cfg.MaxBuckets
+	if maxBuckets == 0 {
+		maxBuckets = 100000
+	}
+
+	m := &Meter{
+		logger:        logger,
+		clock:         clock.Real{},
+		bucket:        bucket,
+		flushInterval: flushInterval,
+		maxBuckets:    maxBuckets,
+		buckets:       make(map[bucketKey]counters),
+	}
+	m.SetDB(db)
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// SetDB replaces the postgres connection of the meter, e.g. after reconnect
+func (m *Meter) SetDB(db *postgres.PostgreSQL) {
+	m.repo.Store(NewRepository(db))
+}
+
+// RecordUsage adds the request to its bucket
+func (m *Meter) RecordUsage(u limiter.Usage) {
+	k := bucketKey{
+		bucket: u.Time.UTC().Truncate(m.bucket),
+		tenant: u.Tenant,
+		key:    u.Key,
+		route:  u.Route,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.buckets[k]
+	if !ok && len(m.buckets) >= m.maxBuckets {
+		m.dropped++
+		return
+	}
+
+	if u.Allowed {
+		c.allowed++
+		c.cost += u.Cost
+	} else {
+		c.rejected++
+		c.rejectedCost += u.Cost
+	}
+	m.buckets[k] = c
+}
+
+// Repository return repository used by the meter
+func (m *Meter) Repository() *Repository {
+	return m.repo.Load()
+}
+
+// Start flushes usage every flush interval until ctx is done, then flushes the rest
+func (m *Meter) Start(ctx context.Context) {
+	ticker := m.clock.NewTicker(m.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := m.Flush(ctx); err != nil {
+				m.logger.Errorf("failed to flush usage: %v", err)
+			}
+		case <-ctx.Done():
+			// ctx is done, use a new one for the last flush
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := m.Flush(flushCtx); err != nil {
+				m.logger.Errorf("failed to flush usage: %v", err)
+			}
+			cancel()
+
+			return
+		}
+	}
+}
+
+// Flush saves aggregated usage. Usage is kept in memory until the next flush if saving fails
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	buckets := m.buckets
+	dropped := m.dropped
+	m.buckets = make(map[bucketKey]counters)
+	m.dropped = 0
+	m.mu.Unlock()
+
+	if dropped > 0 {
+		m.logger.Warnf("usage of %d requests was dropped, %d buckets are kept in memory at most", dropped, m.maxBuckets)
+	}
+
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	var store bucketStore = m.repo.Load()
+	if m.store != nil {
+		store = m.store
+	}
+
+	if err := store.Add(ctx, buckets); err != nil {
+		m.merge(buckets)
+		return err
+	}
+
+	return nil
+}
+
+// merge returns not saved buckets, usage of buckets over maxBuckets is dropped
+func (m *Meter) merge(buckets map[bucketKey]counters) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, c := range buckets {
+		cur, ok := m.buckets[k]
+		if !ok && len(m.buckets) >= m.maxBuckets {
+			m.dropped += c.allowed + c.rejected
+			continue
+		}
+
+		cur.allowed += c.allowed
+		cur.rejected += c.rejected
+		cur.cost += c.cost
+		cur.rejectedCost += c.rejectedCost
+		m.buckets[k] = cur
+	}
+}
@@ -0,0 +1,150 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/limiter"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storeMock saves added buckets or fails with err
+type storeMock struct {
+	mu    sync.Mutex
+	err   error
+	added []map[bucketKey]counters
+}
+
+func (s *storeMock) Add(_ context.Context, buckets map[bucketKey]counters) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.added = append(s.added, buckets)
+
+	return nil
+}
+
+func (s *storeMock) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.added)
+}
+
+func newTestMeter(t *testing.T, maxBuckets int) (*Meter, *storeMock) {
+	t.Helper()
+
+	store := &storeMock{}
+
+	m := NewMeter(log.New(log.WithLogLevel(log.ERROR)), nil, Config{Bucket: 3600, FlushInterval: 10, MaxBuckets: maxBuckets})
+	m.store = store
+
+	return m, store
+}
+
+func TestMeter(t *testing.T) {
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	key := func(route string) bucketKey {
+		return bucketKey{bucket: hour, tenant: "1", key: "127.0.0.1", route: route}
+	}
+	record := func(m *Meter, route string, at time.Time, allowed bool, cost int64) {
+		m.RecordUsage(limiter.Usage{Time: at, Tenant: "1", Key: "127.0.0.1", Route: route, Allowed: allowed, Cost: cost})
+	}
+
+	t.Run("aggregate requests by bucket", func(t *testing.T) {
+		m, store := newTestMeter(t, 10)
+
+		record(m, "/a", hour, true, 2)
+		record(m, "/a", hour.Add(59*time.Minute), true, 3)
+		record(m, "/a", hour.Add(30*time.Minute), false, 4)
+		record(m, "/b", hour, true, 1)
+		record(m, "/a", hour.Add(time.Hour), true, 1)
+
+		require.NoError(t, m.Flush(context.Background()))
+		require.Len(t, store.added, 1)
+		assert.Equal(t, map[bucketKey]counters{
+			key("/a"): {allowed: 2, rejected: 1, cost: 5, rejectedCost: 4},
+			key("/b"): {allowed: 1, cost: 1},
+			{bucket: hour.Add(time.Hour), tenant: "1", key: "127.0.0.1", route: "/a"}: {allowed: 1, cost: 1},
+		}, store.added[0])
+
+		require.NoError(t, m.Flush(context.Background()))
+		assert.Len(t, store.added, 1, "empty buckets are not saved")
+	})
+
+	t.Run("keep buckets until saved", func(t *testing.T) {
+		m, store := newTestMeter(t, 10)
+		store.err = errors.New("postgres is down")
+
+		record(m, "/a", hour, true, 2)
+		require.Error(t, m.Flush(context.Background()))
+
+		record(m, "/a", hour, false, 1)
+		require.Error(t, m.Flush(context.Background()))
+
+		store.err = nil
+		require.NoError(t, m.Flush(context.Background()))
+		require.Len(t, store.added, 1)
+		assert.Equal(t, map[bucketKey]counters{key("/a"): {allowed: 1, rejected: 1, cost: 2, rejectedCost: 1}}, store.added[0])
+	})
+
+	t.Run("drop usage over max buckets", func(t *testing.T) {
+		m, store := newTestMeter(t, 2)
+		store.err = errors.New("postgres is down")
+
+		record(m, "/a", hour, true, 1)
+		record(m, "/b", hour, true, 1)
+		require.Error(t, m.Flush(context.Background()))
+
+		record(m, "/c", hour, true, 1)
+		record(m, "/a", hour, true, 1)
+		assert.Len(t, m.buckets, 2)
+		assert.Equal(t, int64(1), m.dropped)
+
+		store.err = nil
+		require.NoError(t, m.Flush(context.Background()))
+		assert.Equal(t, map[bucketKey]counters{
+			key("/a"): {allowed: 2, cost: 2},
+			key("/b"): {allowed: 1, cost: 1},
+		}, store.added[0])
+	})
+}
+
+func TestMeterStart(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	store := &storeMock{}
+	m := NewMeter(log.New(log.WithLogLevel(log.ERROR)), nil, Config{Bucket: 3600, FlushInterval: 10, MaxBuckets: 10}, WithClock(c))
+	m.store = store
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Start(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+	m.RecordUsage(limiter.Usage{Time: c.Now(), Key: "127.0.0.1", Route: "/a", Allowed: true, Cost: 1})
+	c.Advance(9 * time.Second)
+	assert.Zero(t, store.count(), "flushed only after the flush interval")
+
+	c.Advance(time.Second)
+	require.Eventually(t, func() bool { return store.count() == 1 }, time.Second, time.Millisecond)
+
+	// the rest is flushed on stop
+	m.RecordUsage(limiter.Usage{Time: c.Now(), Key: "127.0.0.1", Route: "/a", Allowed: false, Cost: 1})
+	cancel()
+	<-done
+	assert.Equal(t, 2, store.count())
+}
@@ -0,0 +1,12 @@
+package usage
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(m *Meter)
+
+// WithClock - clock of flushes. Default clock.Real
+func WithClock(c clock.Clock) Option {
+	return func(m *Meter) {
+		m.clock = c
+	}
+}
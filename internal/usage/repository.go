@@ -0,0 +1,125 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Harardin/rate-limit/pkg/postgres"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type Repository struct {
+	db *postgres.PostgreSQL
+}
+
+func NewRepository(db *postgres.PostgreSQL) *Repository {
+	return &Repository{db: db}
+}
+
+// Add adds counters to the stored buckets
+func (r *Repository) Add(ctx context.Context, buckets map[bucketKey]counters) error {
+	batch := &pgx.Batch{}
+	for k, c := range buckets {
+		batch.Queue(`
+			INSERT INTO usage_buckets (bucket, tenant, key, route, allowed, rejected, cost, rejected_cost)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (bucket, tenant, key, route) DO UPDATE SET
+				allowed = usage_buckets.allowed + EXCLUDED.allowed,
+				rejected = usage_buckets.rejected + EXCLUDED.rejected,
+				cost = usage_buckets.cost + EXCLUDED.cost,
+				rejected_cost = usage_buckets.rejected_cost + EXCLUDED.rejected_cost`,
+			k.bucket, k.tenant, k.key, k.route, c.allowed, c.rejected, c.cost, c.rejectedCost,
+		)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save usage: %v", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Query return usage aggregated by query GroupBy columns
+func (r *Repository) Query(ctx context.Context, q Query) ([]Row, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	where := []string{"bucket >= $1", "bucket < $2"}
+	args := []any{q.From, q.To}
+
+	for column, value := range map[string]string{GroupByTenant: q.Tenant, GroupByKey: q.Key, GroupByRoute: q.Route} {
+		if value == "" {
+			continue
+		}
+
+		args = append(args, value)
+		where = append(where, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	// group by columns are validated against the whitelist
+	columns := strings.Join(q.GroupBy, ", ")
+	selectColumns := columns
+	if selectColumns != "" {
+		selectColumns += ", "
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT %s sum(allowed), sum(rejected), sum(cost), sum(rejected_cost)
+		FROM usage_buckets
+		WHERE %s`, selectColumns, strings.Join(where, " AND "))
+
+	if columns != "" {
+		sql += fmt.Sprintf(" GROUP BY %s ORDER BY %s", columns, columns)
+	}
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select usage: %v", err)
+	}
+	defer rows.Close()
+
+	res := make([]Row, 0)
+	for rows.Next() {
+		var row Row
+
+		dest := make([]any, 0, len(q.GroupBy)+4)
+		for _, column := range q.GroupBy {
+			switch column {
+			case GroupByBucket:
+				dest = append(dest, &row.Bucket)
+			case GroupByTenant:
+				dest = append(dest, &row.Tenant)
+			case GroupByKey:
+				dest = append(dest, &row.Key)
+			case GroupByRoute:
+				dest = append(dest, &row.Route)
+			}
+		}
+
+		var allowed, rejected, cost, rejectedCost *int64
+		dest = append(dest, &allowed, &rejected, &cost, &rejectedCost)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		// sum of empty set is null
+		if allowed == nil {
+			continue
+		}
+
+		row.Allowed, row.Rejected, row.Cost, row.RejectedCost = *allowed, *rejected, *cost, *rejectedCost
+		res = append(res, row)
+	}
+
+	return res, rows.Err()
+}
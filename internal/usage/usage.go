@@ -0,0 +1,87 @@
+package usage
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	Enabled bool `json:"USAGE_ENABLED"`
+	// Aggregation bucket. In seconds. Default 1 hour
+	Bucket int `json:"USAGE_BUCKET" default:"3600"`
+	// In seconds. Default 10 seconds
+	FlushInterval int `json:"USAGE_FLUSH_INTERVAL" default:"10"`
+	// MaxBuckets kept in memory, e.g. while postgres is unavailable. Usage of new buckets over the limit is dropped.
+	// Default 100000
+	MaxBuckets int `json:"USAGE_MAX_BUCKETS" default:"100000"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Bucket, validation.Required, validation.Min(60)),
+		validation.Field(&c.FlushInterval, validation.Required, validation.Min(1)),
+		validation.Field(&c.MaxBuckets, validation.Required, validation.Min(1)),
+	)
+}
+
+// Group by columns
+const (
+	GroupByBucket = "bucket"
+	GroupByTenant = "tenant"
+	GroupByKey    = "key"
+	GroupByRoute  = "route"
+)
+
+var groupByColumns = []any{GroupByBucket, GroupByTenant, GroupByKey, GroupByRoute}
+
+type Row struct {
+	Bucket       time.Time `json:"bucket,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Key          string    `json:"key,omitempty"`
+	Route        string    `json:"route,omitempty"`
+	Allowed      int64     `json:"allowed"`
+	Rejected     int64     `json:"rejected"`
+	Cost         int64     `json:"cost"`
+	RejectedCost int64     `json:"rejected_cost"`
+}
+
+// Query selects usage between From (inclusive) and To (exclusive)
+type Query struct {
+	From time.Time
+	To   time.Time
+	// Optional filters
+	Tenant string
+	Key    string
+	Route  string
+	// GroupBy columns, e.g. route. Empty GroupBy return totals
+	GroupBy []string
+}
+
+func (q *Query) Validate() error {
+	return validation.ValidateStruct(
+		q,
+		validation.Field(&q.From, validation.Required),
+		validation.Field(&q.To, validation.Required, validation.Min(q.From)),
+		validation.Field(&q.GroupBy, validation.Each(validation.In(groupByColumns...))),
+	)
+}
+
+type bucketKey struct {
+	bucket time.Time
+	tenant string
+	key    string
+	route  string
+}
+
+type counters struct {
+	allowed      int64
+	rejected     int64
+	cost         int64
+	rejectedCost int64
+}
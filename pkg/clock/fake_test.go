@@ -0,0 +1,53 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+
+	after := c.After(time.Minute)
+	ticker := c.NewTicker(10 * time.Second)
+	assert.Equal(t, 2, c.Waiters())
+
+	c.Advance(9 * time.Second)
+	assert.Equal(t, start.Add(9*time.Second), c.Now())
+	assertNoTick(t, after)
+	assertNoTick(t, ticker.C())
+
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(10*time.Second), <-ticker.C())
+
+	// late ticker delivers one tick
+	c.Advance(50 * time.Second)
+	assert.Equal(t, start.Add(20*time.Second), <-ticker.C())
+	assertNoTick(t, ticker.C())
+	assert.Equal(t, start.Add(time.Minute), <-after)
+	assert.Equal(t, 1, c.Waiters(), "fired timer is removed")
+
+	assert.Equal(t, time.Minute, c.Since(start))
+	assert.Equal(t, -time.Minute, c.Until(start))
+
+	ticker.Stop()
+	assert.Zero(t, c.Waiters())
+
+	c.Advance(time.Hour)
+	assertNoTick(t, ticker.C())
+}
+
+func assertNoTick(t *testing.T, c <-chan time.Time) {
+	t.Helper()
+
+	select {
+	case v := <-c:
+		t.Fatalf("unexpected tick %s", v)
+	default:
+	}
+}
@@ -3,12 +3,17 @@ package consul
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 )
 
 type Consul interface {
 	GetValue(ctx context.Context, path, key string) ([]byte, error)
+	// ListValues return all values of path by keys with a single recursive call and the consul index of path.
+	// If index is not 0 it is a blocking query, which returns when index of path is changed or wait is passed
+	ListValues(ctx context.Context, path string, index uint64, wait time.Duration) (map[string][]byte, uint64, error)
 	GetServiceAddress(ctx context.Context, serviceName string) (GetServiceAddressResponse, error)
 }
 
@@ -40,12 +45,8 @@ func NewConsul(serviceName, standName, consulAddr, consulToken string) (Consul,
 }
 
 func (s *service) GetValue(ctx context.Context, path, key string) ([]byte, error) {
-	if path == "local" {
-		path = path + "/" + s.serviceName
-	}
-
-	fullPath := fmt.Sprintf("%s/%s/%s", s.standName, path, key)
-	pair, _, err := s.kv.Get(fullPath, nil)
+	fullPath := s.prefix(path) + key
+	pair, _, err := s.kv.Get(fullPath, (&api.QueryOptions{}).WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +58,37 @@ func (s *service) GetValue(ctx context.Context, path, key string) ([]byte, error
 	return pair.Value, nil
 }
 
+func (s *service) ListValues(ctx context.Context, path string, index uint64, wait time.Duration) (map[string][]byte, uint64, error) {
+	prefix := s.prefix(path)
+
+	q := &api.QueryOptions{WaitIndex: index, WaitTime: wait}
+	pairs, meta, err := s.kv.List(prefix, q.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, prefix)
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		res[key] = pair.Value
+	}
+
+	return res, meta.LastIndex, nil
+}
+
+// prefix return kv prefix of path, local path is a folder of the service
+func (s *service) prefix(path string) string {
+	if path == "local" {
+		path = path + "/" + s.serviceName
+	}
+
+	return fmt.Sprintf("%s/%s/", s.standName, path)
+}
+
 func (s *service) GetServiceAddress(ctx context.Context, serviceName string) (GetServiceAddressResponse, error) {
 	r, _, err := s.health.Service(serviceName, "", true, nil)
 	if err != nil {
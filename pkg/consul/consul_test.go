@@ -0,0 +1,55 @@
+package consul_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/consul"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListValues(t *testing.T) {
+	var queries []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+
+		value := func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		}
+
+		w.Header().Set("X-Consul-Index", "42")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[
+			{"Key": "dev/local/rate-limit/", "Value": null},
+			{"Key": "dev/local/rate-limit/SERVICE_NAME", "Value": "%s"},
+			{"Key": "dev/local/rate-limit/HTTP_READ_TIMEOUT", "Value": "%s"}
+		]`, value("rate-limit"), value("10s"))
+	}))
+	defer srv.Close()
+
+	c, err := consul.NewConsul("rate-limit", "dev", srv.Listener.Addr().String(), "")
+	require.NoError(t, err)
+
+	values, index, err := c.ListValues(context.Background(), "local", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), index)
+	assert.Equal(t, map[string][]byte{
+		"SERVICE_NAME":      []byte("rate-limit"),
+		"HTTP_READ_TIMEOUT": []byte("10s"),
+	}, values)
+
+	_, _, err = c.ListValues(context.Background(), "global", index, time.Minute)
+	require.NoError(t, err)
+
+	require.Len(t, queries, 2)
+	assert.Equal(t, "/v1/kv/dev/local/rate-limit/?recurse=", queries[0])
+	assert.Equal(t, "/v1/kv/dev/global/?index=42&recurse=&wait=60000ms", queries[1])
+}
@@ -3,10 +3,12 @@ package hc
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/Harardin/rate-limit/pkg/clock"
 	"github.com/Harardin/rate-limit/pkg/log"
 
 	"github.com/goccy/go-json"
@@ -25,11 +27,14 @@ type Config struct {
 type Server struct {
 	logger log.Logger
 	config Config
+	clock  clock.Clock
 
 	mu       sync.Mutex
 	services map[string]*Service
 
-	srv *http.Server
+	// srvMu guards config and srv, srv is nil until Start
+	srvMu sync.Mutex
+	srv   *http.Server
 }
 
 type CheckFunc func() error
@@ -50,10 +55,16 @@ type Service struct {
 
 type Services map[string]*Service
 
-func NewServer(logger log.Logger, config Config) *Server {
+func NewServer(logger log.Logger, config Config, opts ...Option) *Server {
+	options := Options{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return &Server{
 		logger:   logger,
 		config:   config,
+		clock:    options.Clock,
 		services: make(Services),
 	}
 }
@@ -73,21 +84,32 @@ func NewService(timeout int, checkFunc CheckFunc, checkFuncAfterHook CheckFunc)
 	}
 }
 
-// Start health check server
+// SetConfig replaces the config, it is applied on the next Start
+func (s *Server) SetConfig(config Config) {
+	s.srvMu.Lock()
+	s.config = config
+	s.srvMu.Unlock()
+}
+
+// Start health check server. The port is bound before return, so a busy port is returned as error
 //
 // Documentation available there
 // https://yt.heronodes.io/articles/FP-A-15/Healthcheck-requires
-func (s *Server) Start() {
-	if s.config.InActive {
-		return
+func (s *Server) Start() error {
+	s.srvMu.Lock()
+	config := s.config
+	s.srvMu.Unlock()
+
+	if config.InActive {
+		return nil
 	}
 
-	port := s.config.Port
+	port := config.Port
 	if port == "" {
 		port = "10002"
 	}
 
-	endpoint := s.config.Endpoint
+	endpoint := config.Endpoint
 	if endpoint == "" {
 		endpoint = "/hc"
 	}
@@ -108,11 +130,24 @@ func (s *Server) Start() {
 		}
 	})
 
-	s.srv = &http.Server{Addr: ":" + port, Handler: r}
+	srv := &http.Server{Addr: ":" + port, Handler: r}
 
-	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		s.logger.Fatalf("failed to start health check server on port %s: %v", port, err)
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start health check server on port %s: %v", port, err)
 	}
+
+	s.srvMu.Lock()
+	s.srv = srv
+	s.srvMu.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Errorf("health check server on port %s is stopped: %v", port, err)
+		}
+	}()
+
+	return nil
 }
 
 func (s *Server) RegisterService(serviceName string, service *Service) {
@@ -134,7 +169,7 @@ func (s *Server) RegisterService(serviceName string, service *Service) {
 		go func(serivce *Service) {
 			for {
 				select {
-				case <-time.After(serivce.CheckTimeout):
+				case <-s.clock.After(serivce.CheckTimeout):
 					// Execute checking func
 					if err := service.CheckFunc(); err != nil {
 						s.UpdateServiceCode(serviceName, 1)
@@ -202,6 +237,9 @@ func (s *Server) GetServicesCode() map[string]int {
 }
 
 func (s *Server) GetServiceCode(serviceName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	service, ok := s.services[serviceName]
 	if !ok {
 		return 0, fmt.Errorf("service %s does not exist", serviceName)
@@ -211,6 +249,9 @@ func (s *Server) GetServiceCode(serviceName string) (int, error) {
 }
 
 func (s *Server) GetService(serviceName string) (*Service, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	service, ok := s.services[serviceName]
 	if !ok {
 		return nil, fmt.Errorf("service %s does not exist", serviceName)
@@ -219,8 +260,18 @@ func (s *Server) GetService(serviceName string) (*Service, error) {
 	return service, nil
 }
 
+// Stop health check server. Safe to call if the server was not started or is inactive
 func (s *Server) Stop(ctx context.Context) {
-	if err := s.srv.Shutdown(ctx); err != nil {
+	s.srvMu.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.srvMu.Unlock()
+
+	if srv == nil {
+		return
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
 		s.logger.Errorf("failed to stop health check http server: %v", err)
 	}
 }
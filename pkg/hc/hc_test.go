@@ -0,0 +1,48 @@
+package hc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/hc"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopNotStarted(t *testing.T) {
+	s := hc.NewServer(log.New(), hc.Config{InActive: true})
+	assert.NoError(t, s.Start())
+
+	assert.NotPanics(t, func() {
+		s.Stop(context.Background())
+	})
+}
+
+func TestServiceCheck(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	s := hc.NewServer(log.New(), hc.Config{InActive: true}, hc.WithClock(c))
+
+	svc := hc.NewService(0, func() error {
+		return errors.New("connection refused")
+	}, nil)
+	s.RegisterService("postgres", svc)
+	defer s.DeleteService("postgres")
+
+	// the check loop waits for the check timeout
+	assert.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+	c.Advance(9 * time.Second)
+	code, err := s.GetServiceCode("postgres")
+	assert.NoError(t, err)
+	assert.Zero(t, code, "checked only after 10 seconds")
+
+	c.Advance(time.Second)
+	assert.Eventually(t, func() bool {
+		code, err := s.GetServiceCode("postgres")
+		return err == nil && code == 1
+	}, time.Second, time.Millisecond)
+}
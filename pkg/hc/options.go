@@ -0,0 +1,16 @@
+package hc
+
+import "github.com/Harardin/rate-limit/pkg/clock"
+
+type Option func(*Options)
+
+type Options struct {
+	// Clock of service check loops. Default clock.Real
+	Clock clock.Clock
+}
+
+func WithClock(v clock.Clock) Option {
+	return func(o *Options) {
+		o.Clock = v
+	}
+}
@@ -0,0 +1,262 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type Config struct {
+	// Addr - default :20001
+	Addr string `json:"HTTP_ADDR" default:":20001"`
+	// ReadTimeout - whole request including body. In seconds. Default 10 seconds
+	ReadTimeout int `json:"HTTP_READ_TIMEOUT" default:"10"`
+	// ReadHeaderTimeout - in seconds. Default 5 seconds
+	ReadHeaderTimeout int `json:"HTTP_READ_HEADER_TIMEOUT" default:"5"`
+	// WriteTimeout - in seconds. Default 10 seconds
+	WriteTimeout int `json:"HTTP_WRITE_TIMEOUT" default:"10"`
+	// IdleTimeout - keep-alive connections. In seconds. Default 60 seconds
+	IdleTimeout int `json:"HTTP_IDLE_TIMEOUT" default:"60"`
+	// MaxHeaderBytes - default 1 MB
+	MaxHeaderBytes int `json:"HTTP_MAX_HEADER_BYTES" default:"1048576"`
+	// ShutdownTimeout - time to finish active requests on shutdown. In seconds. Default 10 seconds
+	ShutdownTimeout int `json:"HTTP_SHUTDOWN_TIMEOUT" default:"10"`
+	// H2C enables HTTP/2 without TLS for internal callers
+	H2C bool `json:"HTTP_H2C_ENABLED"`
+	// HTTP3 enables HTTP/3 (QUIC) listener, requires TLS
+	HTTP3 bool `json:"HTTP3_ENABLED"`
+	// HTTP3Addr - udp address. Default HTTP_ADDR
+	HTTP3Addr string `json:"HTTP3_ADDR"`
+	TLS       TLSConfig
+}
+
+func (c *Config) Validate() error {
+	if err := c.TLS.Validate(); err != nil {
+		return err
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Addr, validation.By(func(any) error {
+			if c.Addr == "" {
+				return nil
+			}
+
+			_, _, err := net.SplitHostPort(c.Addr)
+			return err
+		})),
+		validation.Field(&c.ReadTimeout, validation.Min(0)),
+		validation.Field(&c.ReadHeaderTimeout, validation.Min(0)),
+		validation.Field(&c.WriteTimeout, validation.Min(0)),
+		validation.Field(&c.IdleTimeout, validation.Min(0)),
+		validation.Field(&c.MaxHeaderBytes, validation.Min(0)),
+		validation.Field(&c.ShutdownTimeout, validation.Min(0)),
+		validation.Field(&c.HTTP3, validation.When(c.HTTP3 && !c.TLS.Enabled, validation.Empty.Error("http/3 requires TLS_ENABLED"))),
+	)
+}
+
+// Server is http.Server which is shut down gracefully when the context of Serve is done.
+// A new http.Server is created on every Serve, so Server can be restarted.
+type Server struct {
+	logger  log.Logger
+	config  Config
+	handler http.Handler
+
+	// certs is nil if tls is disabled
+	certs *certReloader
+}
+
+func New(logger log.Logger, config Config, handler http.Handler) (*Server, error) {
+	if config.Addr == "" {
+		config.Addr = ":20001"
+	}
+
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 10
+	}
+
+	s := &Server{
+		logger:  logger,
+		config:  config,
+		handler: handler,
+	}
+
+	if config.TLS.Enabled {
+		certs, err := newCertReloader(logger, config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+	}
+
+	return s, nil
+}
+
+// ReloadTLS loads certificates from the config, e.g. after rotation in vault.
+// New handshakes use new certificates, established connections are kept.
+func (s *Server) ReloadTLS(cfg TLSConfig) error {
+	if s.certs == nil {
+		return nil
+	}
+
+	if err := s.certs.load(cfg); err != nil {
+		return err
+	}
+
+	s.logger.Info("tls certificates reloaded")
+
+	return nil
+}
+
+// Addr return listen address
+func (s *Server) Addr() string {
+	return s.config.Addr
+}
+
+func (s *Server) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              s.config.Addr,
+		Handler:           handler,
+		ReadTimeout:       time.Duration(s.config.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(s.config.ReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(s.config.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(s.config.IdleTimeout) * time.Second,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+}
+
+// Serve listens the address and serves requests until ctx is done, then waits for active requests
+// up to the shutdown timeout. Return nil after graceful shutdown.
+func (s *Server) Serve(ctx context.Context) error {
+	ln, pc, err := s.Listen()
+	if err != nil {
+		return err
+	}
+
+	return s.ServeListener(ctx, ln, pc)
+}
+
+// Listen binds the tcp address and the udp address of HTTP/3 if it is enabled, pc is nil otherwise.
+// Listeners are served with ServeListener
+func (s *Server) Listen() (ln net.Listener, pc net.PacketConn, err error) {
+	ln, err = net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen %s: %v", s.config.Addr, err)
+	}
+
+	if s.config.HTTP3 {
+		if pc, err = net.ListenPacket("udp", s.http3Addr()); err != nil {
+			ln.Close()
+			return nil, nil, fmt.Errorf("failed to listen udp %s: %v", s.http3Addr(), err)
+		}
+	}
+
+	return ln, pc, nil
+}
+
+func (s *Server) http3Addr() string {
+	if s.config.HTTP3Addr != "" {
+		return s.config.HTTP3Addr
+	}
+
+	return s.config.Addr
+}
+
+// ServeListener serves requests from ln until ctx is done, see Serve. HTTP/3 is served from pc if it is not nil
+func (s *Server) ServeListener(ctx context.Context, ln net.Listener, pc net.PacketConn) error {
+	handler := s.handler
+
+	var h3 *http3.Server
+	if pc != nil && s.certs != nil {
+		h3 = &http3.Server{
+			Handler:        s.handler,
+			TLSConfig:      http3.ConfigureTLSConfig(s.certs.tlsConfig()),
+			MaxHeaderBytes: s.config.MaxHeaderBytes,
+		}
+
+		// announce HTTP/3 to tcp clients
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h3.SetQuicHeaders(w.Header())
+			s.handler.ServeHTTP(w, r)
+		})
+	}
+
+	if s.config.H2C && s.certs == nil {
+		handler = h2c.NewHandler(handler, &http2.Server{
+			IdleTimeout: time.Duration(s.config.IdleTimeout) * time.Second,
+		})
+	}
+
+	srv := s.newServer(handler)
+
+	if s.certs != nil {
+		srv.TLSConfig = s.certs.tlsConfig()
+		go s.certs.watch(ctx)
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		if s.certs == nil {
+			errCh <- srv.Serve(ln)
+			return
+		}
+
+		// certificates are provided by tls config
+		errCh <- srv.ServeTLS(ln, "", "")
+	}()
+
+	s.logger.Infof("http server is listening on %s", ln.Addr())
+
+	if h3 != nil {
+		go func() {
+			errCh <- h3.Serve(pc)
+		}()
+
+		s.logger.Infof("http/3 server is listening on %s", pc.LocalAddr())
+	}
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+
+	if h3 != nil {
+		// http/3 server doesn't support graceful shutdown yet
+		if err := h3.Close(); err != nil {
+			s.logger.Errorf("failed to close http/3 server: %v", err)
+		}
+		pc.Close()
+	}
+
+	if err != nil {
+		srv.Close()
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		s.logger.Errorf("failed to shutdown http server gracefully: %v", err)
+		srv.Close()
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	s.logger.Info("http server stopped")
+
+	return nil
+}
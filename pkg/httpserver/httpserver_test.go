@@ -0,0 +1,92 @@
+package httpserver_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/httpserver"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "OK")
+	})
+
+	srv, err := httpserver.New(log.New(), httpserver.Config{ShutdownTimeout: 5}, handler)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- srv.ServeListener(ctx, ln, nil)
+		}()
+
+		started = make(chan struct{})
+		resCh := make(chan string)
+		go func() {
+			res, err := http.Get("http://" + ln.Addr().String())
+			if !assert.NoError(t, err) {
+				resCh <- ""
+				return
+			}
+			defer res.Body.Close()
+
+			body, _ := io.ReadAll(res.Body)
+			resCh <- string(body)
+		}()
+
+		<-started
+		cancel()
+
+		assert.Equal(t, "OK", <-resCh, "active request is finished on shutdown")
+		assert.NoError(t, <-done)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	srv, err := httpserver.New(log.New(), httpserver.Config{H2C: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ServeListener(ctx, ln, nil)
+
+	// prior knowledge http/2 without tls
+	c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	res, err := c.Get("http://" + ln.Addr().String())
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
@@ -0,0 +1,270 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Client certificate modes
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// Client certificate identities
+const (
+	ClientCertSubject = "subject"
+	ClientCertSAN     = "san"
+)
+
+type TLSConfig struct {
+	Enabled bool `json:"TLS_ENABLED"`
+	// CertFile and KeyFile are reloaded when files are changed
+	CertFile string `json:"TLS_CERT_FILE"`
+	KeyFile  string `json:"TLS_KEY_FILE"`
+	// Cert and Key - PEM, e.g. from vault. Used if files are not set
+	Cert string `json:"TLS_CERT" secret:"true"`
+	Key  string `json:"TLS_KEY" secret:"true"`
+	// ClientAuth - none, request (verify if given) or require. Default none
+	ClientAuth string `json:"TLS_CLIENT_AUTH" default:"none"`
+	// ClientCAFile or ClientCA (PEM) - CA bundle client certificates are verified with
+	ClientCAFile string `json:"TLS_CLIENT_CA_FILE"`
+	ClientCA     string `json:"TLS_CLIENT_CA" secret:"true"`
+	// ClientCertKey - use client certificate subject CN or first SAN as the rate limit key. Empty - client ip
+	ClientCertKey string `json:"TLS_CLIENT_CERT_KEY"`
+	// Files are checked for changes every reload interval. In seconds. Default 60 seconds
+	ReloadInterval int `json:"TLS_RELOAD_INTERVAL" default:"60"`
+}
+
+func (c *TLSConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.CertFile, validation.When(c.Cert == "", validation.Required.Error("cert file or PEM is required"))),
+		validation.Field(&c.KeyFile, validation.When(c.Key == "", validation.Required.Error("key file or PEM is required"))),
+		validation.Field(&c.ClientAuth, validation.In(ClientAuthNone, ClientAuthRequest, ClientAuthRequire)),
+		validation.Field(&c.ClientCAFile, validation.When(
+			c.ClientCA == "" && c.ClientAuth != "" && c.ClientAuth != ClientAuthNone,
+			validation.Required.Error("client CA file or PEM is required for client auth"),
+		)),
+		validation.Field(&c.ClientCertKey,
+			validation.When(!c.clientAuth(), validation.Empty.Error("client cert key requires client auth")),
+			validation.In(ClientCertSubject, ClientCertSAN),
+		),
+		validation.Field(&c.ReloadInterval, validation.Min(0)),
+	)
+}
+
+func (c *TLSConfig) clientAuth() bool {
+	return c.ClientAuth == ClientAuthRequest || c.ClientAuth == ClientAuthRequire
+}
+
+// certReloader keeps current certificate and client CA. Handshakes always use the latest loaded
+// certificate, so rotation doesn't drop established connections.
+type certReloader struct {
+	logger log.Logger
+
+	config    atomic.Pointer[TLSConfig]
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+	// modTime of loaded files
+	modTime atomic.Int64
+}
+
+func newCertReloader(logger log.Logger, cfg TLSConfig) (*certReloader, error) {
+	r := &certReloader{logger: logger}
+	if err := r.load(cfg); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// load reads certificate and client CA from files or PEM values
+func (r *certReloader) load(cfg TLSConfig) error {
+	modTime := filesModTime(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+
+	certPEM, keyPEM := []byte(cfg.Cert), []byte(cfg.Key)
+	if cfg.CertFile != "" {
+		var err error
+		if certPEM, err = os.ReadFile(cfg.CertFile); err != nil {
+			return fmt.Errorf("failed to read tls cert: %v", err)
+		}
+		if keyPEM, err = os.ReadFile(cfg.KeyFile); err != nil {
+			return fmt.Errorf("failed to read tls key: %v", err)
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse tls cert: %v", err)
+	}
+
+	var pool *x509.CertPool
+	if cfg.clientAuth() {
+		caPEM := []byte(cfg.ClientCA)
+		if cfg.ClientCAFile != "" {
+			if caPEM, err = os.ReadFile(cfg.ClientCAFile); err != nil {
+				return fmt.Errorf("failed to read client CA: %v", err)
+			}
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("failed to parse client CA: no certificates")
+		}
+	}
+
+	r.config.Store(&cfg)
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	r.modTime.Store(modTime)
+
+	return nil
+}
+
+// filesModTime return the latest modification time of files, 0 if files are not set
+func filesModTime(files ...string) int64 {
+	var res int64
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+
+		if st, err := os.Stat(f); err == nil {
+			res = max(res, st.ModTime().UnixNano())
+		}
+	}
+
+	return res
+}
+
+// watch reloads files when they are changed until ctx is done
+func (r *certReloader) watch(ctx context.Context) {
+	cfg := r.config.Load()
+	if cfg.CertFile == "" && cfg.ClientCAFile == "" {
+		return
+	}
+
+	interval := time.Duration(cfg.ReloadInterval) * time.Second
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cfg := r.config.Load()
+			if filesModTime(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile) == r.modTime.Load() {
+				continue
+			}
+
+			if err := r.load(*cfg); err != nil {
+				r.logger.Errorf("failed to reload tls certificates, the previous ones are used: %v", err)
+				continue
+			}
+
+			r.logger.Info("tls certificates reloaded")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// set explicitly, protocols added by http.Server to its copy of the config are not seen by GetConfigForClient
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+
+	// client auth mode is selected on each handshake, so it is changed by reload without restart.
+	// Client certificates are verified in VerifyConnection with the current CA
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		hc := c.Clone()
+		hc.GetConfigForClient = nil
+
+		switch r.config.Load().ClientAuth {
+		case ClientAuthRequest:
+			hc.ClientAuth = tls.RequestClientCert
+			hc.VerifyConnection = r.verifyClient(false)
+		case ClientAuthRequire:
+			hc.ClientAuth = tls.RequireAnyClientCert
+			hc.VerifyConnection = r.verifyClient(true)
+		}
+
+		return hc, nil
+	}
+
+	return c
+}
+
+func (r *certReloader) verifyClient(required bool) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			if required {
+				return errors.New("client certificate is required")
+			}
+			return nil
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         r.clientCAs.Load(),
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+
+		return err
+	}
+}
+
+// ClientCertIdentity return subject CN or the first SAN (DNS, URI, email, IP) of the verified client certificate.
+// Return empty string if the request has no client certificate.
+func ClientCertIdentity(r *http.Request, mode string) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+
+	if mode == ClientCertSAN {
+		switch {
+		case len(cert.URIs) > 0:
+			return cert.URIs[0].String()
+		case len(cert.DNSNames) > 0:
+			return cert.DNSNames[0]
+		case len(cert.EmailAddresses) > 0:
+			return cert.EmailAddresses[0]
+		case len(cert.IPAddresses) > 0:
+			return cert.IPAddresses[0].String()
+		}
+	}
+
+	return cert.Subject.CommonName
+}
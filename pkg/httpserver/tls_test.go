@@ -0,0 +1,244 @@
+package httpserver_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/httpserver"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+
+	serverCert := func(name string) testCert {
+		return newTestCert(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, &ca)
+	}
+
+	client := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		DNSNames:    []string{"billing.internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	dir := t.TempDir()
+	writeServerCert := func(c testCert) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), c.certPEM, 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), c.keyPEM, 0o600))
+	}
+	writeServerCert(serverCert("server-1"))
+
+	cfg := httpserver.TLSConfig{
+		Enabled:       true,
+		CertFile:      filepath.Join(dir, "tls.crt"),
+		KeyFile:       filepath.Join(dir, "tls.key"),
+		ClientAuth:    httpserver.ClientAuthRequire,
+		ClientCA:      string(ca.certPEM),
+		ClientCertKey: httpserver.ClientCertSAN,
+	}
+	require.NoError(t, cfg.Validate())
+
+	noAuth := cfg
+	noAuth.ClientAuth = httpserver.ClientAuthNone
+	assert.Error(t, noAuth.Validate(), "client cert key requires client auth")
+
+	srv, err := httpserver.New(log.New(), httpserver.Config{TLS: cfg}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, httpserver.ClientCertIdentity(r, httpserver.ClientCertSAN))
+	}))
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ServeListener(ctx, ln, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(withCert bool) (string, string, error) {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if withCert {
+			pair, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+			require.NoError(t, err)
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+		defer c.CloseIdleConnections()
+
+		res, err := c.Get("https://" + ln.Addr().String())
+		if err != nil {
+			return "", "", err
+		}
+		defer res.Body.Close()
+		assert.Equal(t, "HTTP/2.0", res.Proto)
+
+		body, err := io.ReadAll(res.Body)
+		return string(body), res.TLS.PeerCertificates[0].Subject.CommonName, err
+	}
+
+	identity, serverName, err := get(true)
+	require.NoError(t, err)
+	assert.Equal(t, "billing.internal", identity)
+	assert.Equal(t, "server-1", serverName)
+
+	_, _, err = get(false)
+	assert.Error(t, err, "client certificate is required")
+
+	t.Run("reload rotated certificate", func(t *testing.T) {
+		writeServerCert(serverCert("server-2"))
+		require.NoError(t, srv.ReloadTLS(cfg))
+
+		_, serverName, err := get(true)
+		require.NoError(t, err)
+		assert.Equal(t, "server-2", serverName)
+	})
+
+	t.Run("reload client auth", func(t *testing.T) {
+		noAuth.ClientCertKey = ""
+		require.NoError(t, srv.ReloadTLS(noAuth))
+
+		identity, _, err := get(false)
+		require.NoError(t, err)
+		assert.Empty(t, identity)
+
+		require.NoError(t, srv.ReloadTLS(cfg))
+		_, _, err = get(false)
+		assert.Error(t, err, "client certificate is required again")
+	})
+}
+
+func TestHTTP3(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+
+	cert := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+
+	cfg := httpserver.Config{
+		HTTP3: true,
+		TLS: httpserver.TLSConfig{
+			Enabled: true,
+			Cert:    string(cert.certPEM),
+			Key:     string(cert.keyPEM),
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	srv, err := httpserver.New(log.New(), cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ServeListener(ctx, ln, pc)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	rt := &http3.RoundTripper{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	defer rt.Close()
+
+	res, err := (&http.Client{Transport: rt}).Get("https://" + pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/3.0", string(body))
+
+	t.Run("alt-svc on tcp listener", func(t *testing.T) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		defer c.CloseIdleConnections()
+
+		res, err := c.Get("https://" + ln.Addr().String())
+		require.NoError(t, err)
+		res.Body.Close()
+
+		assert.Contains(t, res.Header.Get("Alt-Svc"), "h3=")
+	})
+
+	t.Run("requires tls", func(t *testing.T) {
+		assert.Error(t, (&httpserver.Config{HTTP3: true}).Validate())
+	})
+}
@@ -8,12 +8,13 @@ import (
 	"path"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Harardin/rate-limit/internal/config"
+	"github.com/Harardin/rate-limit/pkg/clock"
 	"github.com/Harardin/rate-limit/pkg/consul"
 	"github.com/Harardin/rate-limit/pkg/log"
-	"github.com/Harardin/rate-limit/pkg/utils"
 	"github.com/Harardin/rate-limit/pkg/vault"
 
 	"github.com/cristalhq/aconfig"
@@ -29,15 +30,26 @@ type cfgService struct {
 	logger log.Logger
 
 	initialConfig *initialConfig
-	mainConfig    *config.Config
+	// mainConfig is replaced as a whole, so readers never see a partially applied config
+	mainConfig *atomic.Pointer[config.Config]
 
 	mu   sync.RWMutex
 	envs Envs
 
 	consulClient consul.Consul
 	vaultClient  vault.Vault
+
+	clock clock.Clock
 }
 
+const (
+	// watchWait - max wait time of a consul blocking query
+	watchWait = 5 * time.Minute
+
+	watchMinBackoff = time.Second
+	watchMaxBackoff = time.Minute
+)
+
 type initialConfig struct {
 	// Vault Config
 	VaultEnabled      bool   `json:"VAULT_ENABLED" default:"true"`
@@ -77,8 +89,14 @@ func (c *initialConfig) Validate() error {
 	return nil
 }
 
-// LoadConfig accepts logger to track on config change
-func LoadConfig(l log.Logger, mainConfig *config.Config) chan []string {
+// LoadConfig loads the config into current and replaces it on changes in consul. Readers must load
+// the config from current on each use instead of keeping the pointer
+func LoadConfig(l log.Logger, current *atomic.Pointer[config.Config], opts ...ConfigOption) chan []string {
+	options := ConfigOptions{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	// Load initial config
 	initConfig := new(initialConfig)
 	if err := LoadConfigFromEnv(initConfig); err != nil {
@@ -86,14 +104,24 @@ func LoadConfig(l log.Logger, mainConfig *config.Config) chan []string {
 	}
 
 	// Load local config
-	if err := LoadConfigFromEnv(mainConfig, WithValidation(false)); err != nil {
+	mainConfig := new(config.Config)
+	if err := LoadConfigFromEnv(mainConfig, append(opts, WithValidation(false))...); err != nil {
 		l.Fatalf("failed to load local config: %v", err)
 	}
 
+	if options.Sources != nil {
+		if err := options.Sources.loadLocal(*mainConfig, options.EnvPath); err != nil {
+			l.Fatalf("failed to detect config sources: %v", err)
+		}
+	}
+
+	current.Store(mainConfig)
+
 	cs := cfgService{
 		logger:        l,
 		initialConfig: initConfig,
-		mainConfig:    mainConfig,
+		mainConfig:    current,
+		clock:         options.Clock,
 	}
 
 	// Connect to consul
@@ -125,18 +153,16 @@ func LoadConfig(l log.Logger, mainConfig *config.Config) chan []string {
 		cs.envs = envs
 		cs.mu.Unlock()
 
-		for envName, params := range cs.envs {
-			value := params.Value
-			if params.IsSecret {
-				value = params.ExternalValue
-			}
-
-			if value == nil {
-				continue
-			}
+		if err := ApplyEnvs(mainConfig, envs, envs.names()); err != nil {
+			l.Fatalf("failed to set config from consul and vault: %v", err)
+		}
+		current.Store(mainConfig)
 
-			if err := SetStructFieldValueByJsonTag(mainConfig, cs.envs, envName, value); err != nil {
-				l.Fatalf("failed to set config env \"%s\": %v", envName, err)
+		if options.Sources != nil {
+			for envName, params := range envs {
+				if params.value() != nil {
+					options.Sources.set(envName, params)
+				}
 			}
 		}
 	}
@@ -151,57 +177,186 @@ func LoadConfig(l log.Logger, mainConfig *config.Config) chan []string {
 		return c
 	}
 
-	// Watch consul for changes
-	go func(c chan []string) {
-		for {
-			randomSleepSeconds := utils.GetRandomInt(150, 250)
-			time.Sleep(time.Second * time.Duration(randomSleepSeconds))
+	// Watch kv of the service for changes. A bad value keeps the last good config until it is fixed
+	changed := make(chan struct{}, 1)
+	go cs.watchPath(context.Background(), "local", changed)
+	go cs.watchPath(context.Background(), "global", changed)
+	go cs.reload(context.Background(), changed, c)
 
-			newEnvs, err := cs.getDataFromConsulAndVault()
-			if err != nil {
-				l.Fatalf("getDataFromConsulAndVault error: %v", err)
+	if options.Reload != nil {
+		go func() {
+			for range options.Reload {
+				notify(changed)
 			}
+		}()
+	}
 
-			changedEnvs, err := cs.envs.GetChangedEnvs(newEnvs)
-			if err != nil {
-				l.Errorf("failed to check is equal envs: %v", err)
-				continue
-			}
+	return c
+}
 
-			if len(changedEnvs) == 0 {
-				continue
+// reload applies config changes on notifications of changed until ctx is done and sends names of changed envs to c.
+// Errors of consul and vault are retried with exponential backoff
+func (s *cfgService) reload(ctx context.Context, changed chan struct{}, c chan<- []string) {
+	backoff := watchMinBackoff
+	for {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+
+		changedEnvs, err := s.apply()
+		if errors.Is(err, errLoadEnvs) {
+			s.logger.Errorf("the last good config is kept, retry in %s: %v", backoff, err)
+
+			select {
+			case <-s.clock.After(backoff):
+			case <-ctx.Done():
+				return
 			}
+			backoff = min(backoff*2, watchMaxBackoff)
 
-			cs.mu.Lock()
-			cs.envs = newEnvs
-			cs.mu.Unlock()
+			notify(changed)
+			continue
+		}
+		backoff = watchMinBackoff
 
-			for envName, params := range cs.envs {
-				if !utils.ExistInArray(changedEnvs, envName) {
-					continue
-				}
+		if err != nil {
+			s.logger.Errorf("failed to update config, the last good config is kept: %v", err)
+			continue
+		}
 
-				value := params.Value
-				if params.IsSecret {
-					value = params.ExternalValue
-				}
+		if len(changedEnvs) == 0 {
+			continue
+		}
 
-				if value == nil {
-					continue
-				}
+		s.logger.Info("main config was updated")
 
-				if err := SetStructFieldValueByJsonTag(mainConfig, cs.envs, envName, value); err != nil {
-					l.Fatalf("failed to set config env \"%s\": %v", envName, err)
-				}
+		select {
+		case c <- changedEnvs:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// apply loads envs from consul and vault and replaces the main config if they are changed. Return names of changed envs.
+// The config is changed on a copy, readers keep using the current config until it is replaced
+func (s *cfgService) apply() ([]string, error) {
+	newEnvs, err := s.getDataFromConsulAndVault()
+	if err != nil {
+		return nil, errors.Join(errLoadEnvs, err)
+	}
+
+	s.mu.RLock()
+	changedEnvs, err := s.envs.GetChangedEnvs(newEnvs)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check is equal envs: %v", err)
+	}
+
+	if len(changedEnvs) == 0 {
+		return nil, nil
+	}
+
+	cfg := *s.mainConfig.Load()
+	if err := ApplyEnvs(&cfg, newEnvs, changedEnvs); err != nil {
+		return nil, err
+	}
+	s.mainConfig.Store(&cfg)
+
+	s.mu.Lock()
+	s.envs = newEnvs
+	s.mu.Unlock()
+
+	return changedEnvs, nil
+}
+
+// watchPath runs consul blocking queries on kv prefix of path until ctx is done and notifies changed when the prefix
+// is changed or watchWait is passed, so secrets from vault are re-read too. Errors are retried with exponential backoff
+func (s *cfgService) watchPath(ctx context.Context, path string, changed chan<- struct{}) {
+	var index uint64
+	backoff := watchMinBackoff
+
+	for {
+		_, newIndex, err := s.consulClient.ListValues(ctx, path, index, watchWait)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil && newIndex == 0 {
+			// a query with index 0 doesn't block, so it is repeated with backoff instead of a busy loop
+			notify(changed)
+			err = errors.New("consul returned index 0")
+		}
+
+		if err != nil {
+			s.logger.Errorf("failed to watch consul path \"%s\", retry in %s: %v", path, backoff, err)
+
+			select {
+			case <-s.clock.After(backoff):
+			case <-ctx.Done():
+				return
 			}
+			backoff = min(backoff*2, watchMaxBackoff)
 
-			l.Info("main config was updated")
+			continue
+		}
+		backoff = watchMinBackoff
 
-			c <- changedEnvs
+		// index is reset by consul, e.g. after restore of a snapshot, so the next query must not block
+		if newIndex < index {
+			newIndex = 0
 		}
-	}(c)
+		index = newIndex
 
-	return c
+		notify(changed)
+	}
+}
+
+// notify sends to c without blocking, a pending notification is enough to reload config
+func notify(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// ApplyEnvs sets values of names from envs to a copy of cfg and validates it. cfg is replaced only if all values
+// are set and the config is valid, otherwise cfg is not changed and errors of all bad envs are returned.
+//
+// cfg must not be read concurrently, a shared config is updated on a copy which is stored after ApplyEnvs
+func ApplyEnvs(cfg *config.Config, envs Envs, names []string) error {
+	candidate := *cfg
+
+	var errs []error
+	for _, envName := range names {
+		params, ok := envs[envName]
+		if !ok {
+			continue
+		}
+
+		value := params.value()
+		if value == nil {
+			continue
+		}
+
+		if err := SetStructFieldValueByJsonTag(&candidate, envs, envName, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := candidate.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	*cfg = candidate
+
+	return nil
 }
 
 // LoadConfigFromEnv - load environment variables from `os env`, `.env` file and pass it to struct.
@@ -267,7 +422,18 @@ func (s *cfgService) getDataFromConsulAndVault() (Envs, error) {
 		return nil, fmt.Errorf("empty vault client")
 	}
 
-	result := GetConfigParams(*s.mainConfig)
+	// kv of the service is read with a list call per path instead of a call per env
+	values := make(map[string]map[string][]byte, 2)
+	for _, path := range []string{"local", "global"} {
+		kv, _, err := s.consulClient.ListValues(context.Background(), path, 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get data from consul: %v", err)
+		}
+		values[path] = kv
+	}
+
+	mainConfig := s.mainConfig.Load()
+	result := GetConfigParams(*mainConfig)
 
 	for envName, params := range result {
 		path := "local"
@@ -275,15 +441,7 @@ func (s *cfgService) getDataFromConsulAndVault() (Envs, error) {
 			path = "global"
 		}
 
-		res, err := s.consulClient.GetValue(context.Background(), path, envName)
-		if err != nil && !errors.Is(err, consul.ErrKeyNotExist) {
-			return nil, fmt.Errorf("failed to get data from consul: %v", err)
-		}
-
-		// TODO: implemented in future
-		if params.IsJson {
-			continue
-		}
+		res := values[path][envName]
 
 		consulValue := string(res)
 		if consulValue == "" {
@@ -295,6 +453,14 @@ func (s *cfgService) getDataFromConsulAndVault() (Envs, error) {
 			continue
 		}
 
+		// json secrets keep the vault path in consul
+		if params.IsJson && !params.IsSecret {
+			if err := result.SetJSONValue(envName, res); err != nil {
+				return nil, fmt.Errorf("failed to set env \"%s\" from consul: %v", envName, err)
+			}
+			continue
+		}
+
 		result.SetValue(envName, consulValue)
 
 		// Get data from service discovery
@@ -304,7 +470,7 @@ func (s *cfgService) getDataFromConsulAndVault() (Envs, error) {
 				return nil, fmt.Errorf("failed to get data from consul: %v", err)
 			}
 
-			if s.mainConfig.StandName != "local" && len(res) == 0 {
+			if mainConfig.StandName != "local" && len(res) == 0 {
 				s.logger.Errorf("consul discovery return empty response for consul service \"%s\". env \"%s\" will be empty", consulValue, params.DiscoveryField)
 			}
 
@@ -318,6 +484,18 @@ func (s *cfgService) getDataFromConsulAndVault() (Envs, error) {
 				return nil, fmt.Errorf("failed to get secret from vault: %v", err)
 			}
 
+			if params.IsJson {
+				str, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("json secret of env \"%s\" must be a string", envName)
+				}
+
+				if err := result.SetExternalJSONValue(envName, []byte(str)); err != nil {
+					return nil, fmt.Errorf("failed to set env \"%s\" from vault: %v", envName, err)
+				}
+				continue
+			}
+
 			result.SetExternalValue(envName, value)
 		}
 	}
@@ -3,10 +3,12 @@ package initialconfig
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/Harardin/rate-limit/pkg/utils"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/goccy/go-json"
 )
 
 type configType int
@@ -26,6 +28,9 @@ type envParams struct {
 
 	// Value from vault
 	ExternalValue any
+
+	// fieldType - type json values are decoded into
+	fieldType reflect.Type
 }
 
 type Envs map[string]envParams
@@ -108,80 +113,45 @@ func GetConfigParams(item any, opts ...ConfigParamsOption) Envs {
 			IsJson:         isJson,
 			ConfigType:     options.ConfigType,
 			Value:          fieldValue,
+			fieldType:      f.Type,
 		}
 	}
 
 	return envs
 }
 
+// SetStructFieldValueByJsonTag sets value to the field of st with json tag. Strings are parsed to the field type:
+// numbers with overflow check, bools, durations, time in RFC3339, comma separated slices, pointers and types
+// implementing encoding.TextUnmarshaler. Return *FieldError if the value can't be set
 func SetStructFieldValueByJsonTag(st any, e Envs, tag string, value any) error {
 	if reflect.ValueOf(st).Kind() != reflect.Ptr {
-		return fmt.Errorf("SetStructFieldValueByJsonTag error: struct variable must be a pointer")
+		return fmt.Errorf("SetStructFieldValueByJsonTag error: %w", ErrNotPointer)
 	}
 
 	if e == nil {
-		return fmt.Errorf("SetStructFieldValueByJsonTag error: empty envs")
+		return fmt.Errorf("SetStructFieldValueByJsonTag error: %w", ErrEmptyEnvs)
 	}
 
 	if tag == "" {
-		return fmt.Errorf("SetStructFieldValueByJsonTag error: empty tag")
+		return fmt.Errorf("SetStructFieldValueByJsonTag error: %w", ErrEmptyTag)
 	}
 
 	if value == nil {
-		return fmt.Errorf("SetStructFieldValueByJsonTag error: empty value")
+		return fmt.Errorf("SetStructFieldValueByJsonTag error: %w", ErrEmptyValue)
 	}
 
-	r := reflect.ValueOf(st)
-	if r.Kind() == reflect.Ptr {
-		r = r.Elem()
+	field, f, ok := fieldByTag(reflect.ValueOf(st).Elem(), tag)
+	if !ok {
+		return &FieldError{Env: tag, Value: value, Err: ErrFieldNotFound}
 	}
 
-	for i := 0; i < r.NumField(); i++ {
-		f := r.Type().Field(i)
-		if f.Type.Kind() == reflect.Struct {
-			fieldValue := r.FieldByName(f.Name).Addr().Interface()
-			if err := SetStructFieldValueByJsonTag(fieldValue, e, tag, value); err != nil {
-				panic(err)
-			}
-			continue
-		}
-
-		envName := f.Tag.Get("json")
-		if envName == "" || envName == "-" || envName != tag {
-			continue
-		}
-
-		val := reflect.ValueOf(value)
-		if val.Type().String() == "string" && val.Type().String() != f.Type.String() {
-			valStr := value.(string)
-			switch f.Type.String() {
-			case "int", "int32", "int64", "uint", "uint32", "uint64", "int16", "uint16", "int8", "uint8":
-				nv, err := strconv.Atoi(valStr)
-				if err != nil {
-					panic(err)
-				}
-				val = reflect.ValueOf(nv)
-			case "float32", "float64":
-				nv, err := strconv.ParseFloat(valStr, 64)
-				if err != nil {
-					panic(err)
-				}
-				val = reflect.ValueOf(nv)
-			case "bool":
-				var nv bool
-				if utils.ExistInArray([]string{"1", "true"}, valStr) {
-					nv = true
-				}
-				val = reflect.ValueOf(nv)
-			case "[]string":
-				nv := strings.Split(valStr, ",")
-				val = reflect.ValueOf(nv)
-			}
-		}
-
-		r.FieldByName(f.Name).Set(val.Convert(f.Type))
+	v, err := convertValue(f.Type, value)
+	if err != nil {
+		return &FieldError{Env: tag, Field: f.Name, Value: value, Err: err}
 	}
 
+	field.Set(v)
+
 	return nil
 }
 
@@ -233,6 +203,99 @@ func (s *Envs) SetExternalValue(envName string, v any) {
 	(*s)[envName] = params
 }
 
+// SetJSONValue decodes json value of the env with is_json tag into the type of its field, e.g. a map, a slice
+// or a struct, and validates it
+func (s *Envs) SetJSONValue(envName string, data []byte) error {
+	params, ok := (*s)[envName]
+	if !ok {
+		return nil
+	}
+
+	v, err := decodeJSON(params.fieldType, data)
+	if err != nil {
+		return err
+	}
+
+	s.SetValue(envName, v)
+
+	return nil
+}
+
+// SetExternalJSONValue decodes json secret of the env with is_json tag like SetJSONValue
+func (s *Envs) SetExternalJSONValue(envName string, data []byte) error {
+	params, ok := (*s)[envName]
+	if !ok {
+		return nil
+	}
+
+	v, err := decodeJSON(params.fieldType, data)
+	if err != nil {
+		return err
+	}
+
+	s.SetExternalValue(envName, v)
+
+	return nil
+}
+
+// decodeJSON return data decoded into a value of the field type
+func decodeJSON(t reflect.Type, data []byte) (any, error) {
+	if t == nil {
+		return nil, fmt.Errorf("unknown type of json env")
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("bad json value: %v", err)
+	}
+
+	if err := validateJSON(v.Elem()); err != nil {
+		return nil, fmt.Errorf("invalid json value: %v", err)
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+// validateJSON validates decoded value. Unlike validation.Validate elements of slices are validated
+// with Validate of pointer receiver, e.g. a list of rules
+func validateJSON(v reflect.Value) error {
+	validatable := reflect.TypeOf((*validation.Validatable)(nil)).Elem()
+
+	if v.Kind() == reflect.Slice && !v.Type().Elem().Implements(validatable) && reflect.PointerTo(v.Type().Elem()).Implements(validatable) {
+		errs := validation.Errors{}
+		for i := 0; i < v.Len(); i++ {
+			if err := v.Index(i).Addr().Interface().(validation.Validatable).Validate(); err != nil {
+				errs[strconv.Itoa(i)] = err
+			}
+		}
+
+		return errs.Filter()
+	}
+
+	// pointer is passed, so Validate of pointer receiver is called for structs
+	return validation.Validate(v.Addr().Interface())
+}
+
+// value return value from vault for secrets
+func (p envParams) value() any {
+	if p.IsSecret {
+		return p.ExternalValue
+	}
+
+	return p.Value
+}
+
+// names return env names sorted, so errors are reported in the same order
+func (s Envs) names() []string {
+	res := make([]string, 0, len(s))
+	for envName := range s {
+		res = append(res, envName)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
 func (s *Envs) GetKeys() []string {
 	res := make([]string, len(*s))
 	for envName := range *s {
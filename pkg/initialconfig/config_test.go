@@ -209,3 +209,170 @@ func TestStructFields(t *testing.T) {
 	}
 
 }
+
+type jsonRule struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+func (r *jsonRule) Validate() error {
+	if r.Limit < 1 {
+		return fmt.Errorf("limit of rule \"%s\" must be positive", r.Name)
+	}
+
+	return nil
+}
+
+func TestJSONValues(t *testing.T) {
+	type jsonConfig struct {
+		LocalConfig struct {
+			Signatures map[string]string `json:"SIGNATURES" is_json:"true"`
+			Rules      []jsonRule        `json:"RULES" is_json:"true"`
+			Token      map[string]string `json:"TOKEN" is_json:"true" secret:"true"`
+		}
+	}
+
+	cfg := new(jsonConfig)
+	envs := initialconfig.GetConfigParams(*cfg)
+
+	require.NoError(t, envs.SetJSONValue("SIGNATURES", []byte(`{"alice": "key1"}`)))
+	require.NoError(t, envs.SetJSONValue("RULES", []byte(`[{"name": "api", "limit": 10}]`)))
+	// consul keeps the vault path of secrets
+	envs.SetValue("TOKEN", "secrets/token")
+	require.NoError(t, envs.SetExternalJSONValue("TOKEN", []byte(`{"user": "secret"}`)))
+
+	for _, name := range []string{"SIGNATURES", "RULES"} {
+		require.NoError(t, initialconfig.SetStructFieldValueByJsonTag(cfg, envs, name, envs[name].Value))
+	}
+	require.NoError(t, initialconfig.SetStructFieldValueByJsonTag(cfg, envs, "TOKEN", envs["TOKEN"].ExternalValue))
+
+	assert.Equal(t, map[string]string{"alice": "key1"}, cfg.LocalConfig.Signatures)
+	assert.Equal(t, []jsonRule{{Name: "api", Limit: 10}}, cfg.LocalConfig.Rules)
+	assert.Equal(t, map[string]string{"user": "secret"}, cfg.LocalConfig.Token)
+
+	t.Run("invalid values", func(t *testing.T) {
+		assert.Error(t, envs.SetJSONValue("SIGNATURES", []byte(`["alice"]`)), "wrong type")
+		assert.Error(t, envs.SetJSONValue("RULES", []byte(`[{"name": "api"}]`)), "validation")
+		assert.Equal(t, map[string]string{"alice": "key1"}, envs["SIGNATURES"].Value, "value is kept on error")
+	})
+
+	t.Run("change detection", func(t *testing.T) {
+		newEnvs := initialconfig.GetConfigParams(*cfg)
+		require.NoError(t, newEnvs.SetJSONValue("SIGNATURES", []byte(`{"alice": "key1"}`)))
+		require.NoError(t, newEnvs.SetJSONValue("RULES", []byte(`[{"name": "api", "limit": 20}]`)))
+		newEnvs.SetValue("TOKEN", "secrets/token")
+		require.NoError(t, newEnvs.SetExternalJSONValue("TOKEN", []byte(`{"user": "secret"}`)))
+
+		changed, err := envs.GetChangedEnvs(newEnvs)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"RULES"}, changed)
+	})
+}
+
+func TestSetStructFieldValueTypes(t *testing.T) {
+	type limits struct {
+		Burst *int `json:"BURST"`
+	}
+
+	type typedConfig struct {
+		Timeout time.Duration `json:"TIMEOUT"`
+		Retries uint8         `json:"RETRIES"`
+		Since   time.Time     `json:"SINCE"`
+		Ports   []int         `json:"PORTS"`
+		Ratio   *float64      `json:"RATIO"`
+		Nested  struct {
+			Name string `json:"NESTED_NAME"`
+		}
+		Limits   *limits
+		Disabled bool `json:"DISABLED"`
+	}
+
+	envs := initialconfig.Envs{}
+	burst, ratio := 5, 0.5
+
+	tt := []struct {
+		tag      string
+		value    any
+		expected func(cfg *typedConfig) any
+		want     any
+		err      error
+	}{
+		{tag: "TIMEOUT", value: "1m30s", expected: func(c *typedConfig) any { return c.Timeout }, want: 90 * time.Second},
+		{tag: "TIMEOUT", value: "90"},
+		{tag: "RETRIES", value: "255", expected: func(c *typedConfig) any { return c.Retries }, want: uint8(255)},
+		{tag: "RETRIES", value: "256", err: initialconfig.ErrOverflow},
+		{tag: "RETRIES", value: "-1"},
+		{tag: "RETRIES", value: 300, err: initialconfig.ErrOverflow},
+		{tag: "RETRIES", value: -1, err: initialconfig.ErrOverflow},
+		{tag: "SINCE", value: "2024-05-01T10:00:00Z", expected: func(c *typedConfig) any { return c.Since }, want: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{tag: "PORTS", value: "80, 443", expected: func(c *typedConfig) any { return c.Ports }, want: []int{80, 443}},
+		{tag: "PORTS", value: "80,http"},
+		{tag: "RATIO", value: "0.5", expected: func(c *typedConfig) any { return c.Ratio }, want: &ratio},
+		{tag: "NESTED_NAME", value: "nested", expected: func(c *typedConfig) any { return c.Nested.Name }, want: "nested"},
+		{tag: "BURST", value: "5", expected: func(c *typedConfig) any { return c.Limits.Burst }, want: &burst},
+		{tag: "DISABLED", value: "yes"},
+		{tag: "UNKNOWN", value: "1", err: initialconfig.ErrFieldNotFound},
+		{tag: "PORTS", value: struct{}{}, err: initialconfig.ErrIncompatibleType},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("%s=%v", tc.tag, tc.value), func(t *testing.T) {
+			cfg := new(typedConfig)
+			err := initialconfig.SetStructFieldValueByJsonTag(cfg, envs, tc.tag, tc.value)
+
+			if tc.expected == nil {
+				var fe *initialconfig.FieldError
+				require.ErrorAs(t, err, &fe)
+				assert.Equal(t, tc.tag, fe.Env)
+				assert.Equal(t, tc.value, fe.Value)
+				if tc.err != nil {
+					assert.ErrorIs(t, err, tc.err)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, tc.expected(cfg))
+		})
+	}
+}
+
+func TestApplyEnvs(t *testing.T) {
+	t.Setenv("DISCOVERY_POSTGRES_SERVICE", "postgres")
+	t.Setenv("DISCOVERY_RABBIT_SERVICE", "rabbit")
+	t.Setenv("DISCOVERY_REDIS_SERVICE", "redis")
+	t.Setenv("POSTGRES_USER", "postgres")
+	t.Setenv("POSTGRES_PASS", "postgres")
+	t.Setenv("POSTGRES_DB_NAME", "limiter")
+	t.Setenv("RABBIT_USER", "guest")
+	t.Setenv("RABBIT_PASS", "guest")
+	t.Setenv("CONSUL_STAND_NAME", "local")
+
+	cfg := new(config.Config)
+	require.NoError(t, initialconfig.LoadConfigFromEnv(cfg, initialconfig.WithEnvPath(t.TempDir()), initialconfig.WithValidation(false)))
+	cfg.PostgresAddrs = consul.GetServiceAddressResponse{{Address: "localhost", Port: 5432}}
+	cfg.RabbitAddrs = consul.GetServiceAddressResponse{{Address: "localhost", Port: 5672}}
+	cfg.RedisAddrs = consul.GetServiceAddressResponse{{Address: "localhost", Port: 6379}}
+	require.NoError(t, cfg.Validate())
+
+	good := *cfg
+
+	envs := initialconfig.GetConfigParams(*cfg)
+	envs.SetValue("SERVICE_NAME", "new name")
+	envs.SetValue("REDIS_DB_INDEX", "one")
+	envs.SetValue("POSTGRES_MAX_CONNS", "99999999999")
+
+	err := initialconfig.ApplyEnvs(cfg, envs, []string{"SERVICE_NAME", "REDIS_DB_INDEX", "POSTGRES_MAX_CONNS"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REDIS_DB_INDEX")
+	assert.Contains(t, err.Error(), "POSTGRES_MAX_CONNS")
+	assert.Equal(t, good, *cfg, "the last good config is kept")
+
+	envs.SetValue("HTTP_READ_TIMEOUT", "-1")
+	err = initialconfig.ApplyEnvs(cfg, envs, []string{"SERVICE_NAME", "HTTP_READ_TIMEOUT"})
+	assert.ErrorContains(t, err, "invalid config")
+	assert.Equal(t, good, *cfg, "invalid config is not applied")
+
+	require.NoError(t, initialconfig.ApplyEnvs(cfg, envs, []string{"SERVICE_NAME"}))
+	assert.Equal(t, "new name", cfg.ServiceName)
+}
@@ -0,0 +1,36 @@
+package initialconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotPointer       = errors.New("struct variable must be a pointer")
+	ErrEmptyEnvs        = errors.New("empty envs")
+	ErrEmptyTag         = errors.New("empty tag")
+	ErrEmptyValue       = errors.New("empty value")
+	ErrFieldNotFound    = errors.New("field is not found")
+	ErrUnsupportedType  = errors.New("unsupported field type")
+	ErrOverflow         = errors.New("value overflows field type")
+	ErrIncompatibleType = errors.New("value type is incompatible with field type")
+
+	// errLoadEnvs is returned when envs are not loaded from consul or vault, the load is retried
+	errLoadEnvs = errors.New("failed to get config from consul and vault")
+)
+
+// FieldError is returned when the env value can't be set to the config field
+type FieldError struct {
+	Env   string
+	Field string
+	Value any
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("env \"%s\" (field %s): bad value \"%v\": %v", e.Env, e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
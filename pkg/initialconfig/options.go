@@ -1,5 +1,7 @@
 package initialconfig
 
+import "github.com/Harardin/rate-limit/pkg/clock"
+
 /* Config options */
 
 type ConfigOption func(*ConfigOptions)
@@ -7,6 +9,13 @@ type ConfigOption func(*ConfigOptions)
 type ConfigOptions struct {
 	EnvPath    string
 	Validation bool
+	// Sources is filled by LoadConfig if it is set
+	Sources Sources
+	// Clock of the consul watcher. Default clock.Real
+	Clock clock.Clock
+	// Reload - each value re-reads consul and vault, changes are sent like changes found by the watcher.
+	// Without consul and vault the config is not changed at runtime, Reload is not read
+	Reload <-chan struct{}
 }
 
 func WithEnvPath(v string) ConfigOption {
@@ -21,6 +30,27 @@ func WithValidation(v bool) ConfigOption {
 	}
 }
 
+// WithSources - LoadConfig sets sources of config values to s
+func WithSources(s Sources) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.Sources = s
+	}
+}
+
+// WithClock - clock of the consul watcher
+func WithClock(c clock.Clock) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.Clock = c
+	}
+}
+
+// WithReload - values of c re-read the config source, e.g. on a control command
+func WithReload(c <-chan struct{}) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.Reload = c
+	}
+}
+
 /* Config params options */
 
 type ConfigParamsOption func(*ConfigParamsOptions)
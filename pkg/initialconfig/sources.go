@@ -0,0 +1,66 @@
+package initialconfig
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/joho/godotenv"
+)
+
+// Source of the config value
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceEnv     Source = "env"
+	SourceDotEnv  Source = ".env"
+	SourceConsul  Source = "consul"
+	SourceVault   Source = "vault"
+)
+
+// Sources - source of the config value by env name
+type Sources map[string]Source
+
+// loadLocal sets sources of values loaded from os env and .env file, other values are defaults
+func (s Sources) loadLocal(cfg any, envPath string) error {
+	if envPath == "" {
+		pwdDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		envPath = pwdDir
+	}
+
+	dotEnv, err := godotenv.Read(path.Join(envPath, ".env"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for envName := range GetConfigParams(cfg) {
+		if _, ok := os.LookupEnv(envName); ok {
+			s[envName] = SourceEnv
+			continue
+		}
+
+		if _, ok := dotEnv[envName]; ok {
+			s[envName] = SourceDotEnv
+			continue
+		}
+
+		s[envName] = SourceDefault
+	}
+
+	return nil
+}
+
+// set sets source of the value from consul or vault
+func (s Sources) set(envName string, params envParams) {
+	if params.IsSecret {
+		s[envName] = SourceVault
+		return
+	}
+
+	s[envName] = SourceConsul
+}
@@ -0,0 +1,252 @@
+package initialconfig
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// fieldByTag return the field with json tag. Nested structs and pointers to structs without the tag are searched too,
+// nil pointers on the way to the field are allocated
+func fieldByTag(v reflect.Value, tag string) (reflect.Value, reflect.StructField, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := jsonName(f)
+		if name == tag {
+			return v.Field(i), f, true
+		}
+
+		// tagged fields are values themselves, e.g. time.Time
+		if name != "" {
+			continue
+		}
+
+		fv := v.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			if res, rf, ok := fieldByTag(fv, tag); ok {
+				return res, rf, true
+			}
+		case f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct:
+			if !hasTag(f.Type.Elem(), tag) {
+				continue
+			}
+
+			if fv.IsNil() {
+				fv.Set(reflect.New(f.Type.Elem()))
+			}
+
+			return fieldByTag(fv.Elem(), tag)
+		}
+	}
+
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+// hasTag check that the struct type has a field with json tag
+func hasTag(t reflect.Type, tag string) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := jsonName(f)
+		if name == tag {
+			return true
+		}
+
+		if name != "" {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() == reflect.Struct && hasTag(ft, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonName return env name from json tag, empty for fields without env
+func jsonName(f reflect.StructField) string {
+	name := f.Tag.Get("json")
+	if i := strings.Index(name, ","); i != -1 {
+		name = name[:i]
+	}
+
+	if name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+// convertValue return value converted to the type t. Strings from env, consul and vault are parsed
+func convertValue(t reflect.Type, value any) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+
+	if s, ok := value.(string); ok && t.Kind() != reflect.String {
+		return parseValue(t, s)
+	}
+
+	if t.Kind() == reflect.Pointer {
+		elem, err := convertValue(t.Elem(), value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		res := reflect.New(t.Elem())
+		res.Elem().Set(elem)
+
+		return res, nil
+	}
+
+	if !v.CanConvert(t) {
+		return reflect.Value{}, fmt.Errorf("%w: %s to %s", ErrIncompatibleType, v.Type(), t)
+	}
+
+	res := reflect.New(t).Elem()
+	switch {
+	case isInt(t.Kind()) && isInt(v.Kind()):
+		if res.OverflowInt(v.Int()) {
+			return reflect.Value{}, fmt.Errorf("%w %s", ErrOverflow, t)
+		}
+	case isUint(t.Kind()) && isInt(v.Kind()):
+		if v.Int() < 0 || res.OverflowUint(uint64(v.Int())) {
+			return reflect.Value{}, fmt.Errorf("%w %s", ErrOverflow, t)
+		}
+	case isUint(t.Kind()) && isUint(v.Kind()):
+		if res.OverflowUint(v.Uint()) {
+			return reflect.Value{}, fmt.Errorf("%w %s", ErrOverflow, t)
+		}
+	case isInt(t.Kind()) && isUint(v.Kind()):
+		if v.Uint() > uint64(1)<<(t.Bits()-1)-1 {
+			return reflect.Value{}, fmt.Errorf("%w %s", ErrOverflow, t)
+		}
+	case isFloat(t.Kind()) && isFloat(v.Kind()):
+		if res.OverflowFloat(v.Float()) {
+			return reflect.Value{}, fmt.Errorf("%w %s", ErrOverflow, t)
+		}
+	}
+
+	return v.Convert(t), nil
+}
+
+// parseValue parses string to the type t. Slices are comma separated
+func parseValue(t reflect.Type, s string) (reflect.Value, error) {
+	res := reflect.New(t).Elem()
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		if err := res.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, err
+		}
+
+		return res, nil
+	}
+
+	switch {
+	case t == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res.SetInt(int64(d))
+	case isInt(t.Kind()):
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, numError(t, err)
+		}
+		res.SetInt(n)
+	case isUint(t.Kind()):
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, numError(t, err)
+		}
+		res.SetUint(n)
+	case isFloat(t.Kind()):
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), t.Bits())
+		if err != nil {
+			return reflect.Value{}, numError(t, err)
+		}
+		res.SetFloat(n)
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res.SetBool(b)
+	case t.Kind() == reflect.String:
+		res.SetString(s)
+	case t.Kind() == reflect.Slice:
+		parts := strings.Split(s, ",")
+		if s == "" {
+			parts = nil
+		}
+
+		res = reflect.MakeSlice(t, 0, len(parts))
+		for i, part := range parts {
+			if t.Elem().Kind() != reflect.String {
+				part = strings.TrimSpace(part)
+			}
+
+			elem, err := parseValue(t.Elem(), part)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			res = reflect.Append(res, elem)
+		}
+	case t.Kind() == reflect.Pointer:
+		elem, err := parseValue(t.Elem(), s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res = reflect.New(t.Elem())
+		res.Elem().Set(elem)
+	default:
+		return reflect.Value{}, fmt.Errorf("%w %s", ErrUnsupportedType, t)
+	}
+
+	return res, nil
+}
+
+// numError return ErrOverflow for values out of range
+func numError(t reflect.Type, err error) error {
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return fmt.Errorf("%w %s", ErrOverflow, t)
+	}
+
+	return err
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
@@ -0,0 +1,319 @@
+package initialconfig
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/internal/config"
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/consul"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// consulMock answers blocking queries like consul: a query with the current index waits for a change or the wait time
+type consulMock struct {
+	clock   *clock.Fake
+	queries chan uint64
+
+	mu      sync.Mutex
+	values  map[string]map[string][]byte
+	index   uint64
+	err     error
+	changed chan struct{}
+}
+
+func newConsulMock(c *clock.Fake, index uint64) *consulMock {
+	return &consulMock{
+		clock:   c,
+		queries: make(chan uint64, 100),
+		values:  map[string]map[string][]byte{"local": {}, "global": {}},
+		index:   index,
+		changed: make(chan struct{}),
+	}
+}
+
+// set changes the value and the index, blocked queries return
+func (m *consulMock) set(key, value string, index uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values["local"][key] = []byte(value)
+	m.index = index
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *consulMock) setErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
+
+func (m *consulMock) GetValue(context.Context, string, string) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *consulMock) ListValues(ctx context.Context, path string, index uint64, wait time.Duration) (map[string][]byte, uint64, error) {
+	if wait > 0 {
+		m.queries <- index
+	}
+
+	m.mu.Lock()
+	changed, err := m.changed, m.err
+	blocking := index != 0 && index == m.index
+	m.mu.Unlock()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if blocking {
+		select {
+		case <-changed:
+		case <-m.clock.After(wait):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kv := make(map[string][]byte, len(m.values[path]))
+	for k, v := range m.values[path] {
+		kv[k] = v
+	}
+
+	return kv, m.index, nil
+}
+
+func (m *consulMock) GetServiceAddress(context.Context, string) (consul.GetServiceAddressResponse, error) {
+	return nil, nil
+}
+
+type vaultMock struct{}
+
+func (vaultMock) GetSecret(context.Context, string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (vaultMock) GetSecretByKey(context.Context, string, string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+var testNow = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T, index uint64) (*cfgService, *consulMock, *clock.Fake) {
+	c := clock.NewFake(testNow)
+	m := newConsulMock(c, index)
+
+	return &cfgService{
+		logger:       log.New(log.WithLogLevel(log.ERROR)),
+		consulClient: m,
+		vaultClient:  vaultMock{},
+		clock:        c,
+	}, m, c
+}
+
+// nextQuery return index of the next watch query
+func nextQuery(t *testing.T, m *consulMock) uint64 {
+	t.Helper()
+
+	select {
+	case index := <-m.queries:
+		return index
+	case <-time.After(time.Second):
+		require.Fail(t, "no consul query")
+		return 0
+	}
+}
+
+func waitNotify(t *testing.T, changed <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		require.Fail(t, "config change is not notified")
+	}
+}
+
+func TestWatchPath(t *testing.T) {
+	t.Run("index reset", func(t *testing.T) {
+		s, m, _ := newTestService(t, 10)
+		changed := make(chan struct{}, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.watchPath(ctx, "local", changed)
+
+		assert.Equal(t, uint64(0), nextQuery(t, m))
+		waitNotify(t, changed)
+		assert.Equal(t, uint64(10), nextQuery(t, m))
+
+		// e.g. consul is restored from a snapshot
+		m.set("SERVICE_NAME", "restored", 3)
+		waitNotify(t, changed)
+		assert.Equal(t, uint64(0), nextQuery(t, m), "the query after reset must not block")
+		assert.Equal(t, uint64(3), nextQuery(t, m))
+	})
+
+	t.Run("forced reload after wait", func(t *testing.T) {
+		s, m, c := newTestService(t, 5)
+		changed := make(chan struct{}, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.watchPath(ctx, "local", changed)
+
+		nextQuery(t, m)
+		waitNotify(t, changed)
+		assert.Equal(t, uint64(5), nextQuery(t, m))
+		require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+		c.Advance(watchWait)
+		waitNotify(t, changed)
+		assert.Equal(t, uint64(5), nextQuery(t, m))
+	})
+
+	backoff := func(t *testing.T, m *consulMock, c *clock.Fake) {
+		t.Helper()
+
+		nextQuery(t, m)
+		for _, d := range []time.Duration{
+			time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute,
+		} {
+			require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+			c.Advance(d - time.Millisecond)
+			require.Equal(t, 1, c.Waiters(), "retry before %s", d)
+
+			c.Advance(time.Millisecond)
+			nextQuery(t, m)
+		}
+	}
+
+	t.Run("error backoff", func(t *testing.T) {
+		s, m, c := newTestService(t, 5)
+		m.setErr(errors.New("connection refused"))
+		changed := make(chan struct{}, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.watchPath(ctx, "local", changed)
+
+		backoff(t, m, c)
+
+		require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+		m.setErr(nil)
+		c.Advance(time.Minute)
+		assert.Equal(t, uint64(0), nextQuery(t, m))
+		waitNotify(t, changed)
+		assert.Equal(t, uint64(5), nextQuery(t, m))
+		require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+		// the backoff is reset after a successful query, the blocked query keeps its timer
+		m.setErr(errors.New("connection refused"))
+		m.set("SERVICE_NAME", "new name", 6)
+		assert.Equal(t, uint64(6), nextQuery(t, m))
+		require.Eventually(t, func() bool { return c.Waiters() == 2 }, time.Second, time.Millisecond)
+		c.Advance(time.Second)
+		nextQuery(t, m)
+	})
+
+	t.Run("index 0 is retried with backoff", func(t *testing.T) {
+		s, m, c := newTestService(t, 0)
+		changed := make(chan struct{}, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.watchPath(ctx, "local", changed)
+
+		backoff(t, m, c)
+		waitNotify(t, changed)
+	})
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("DISCOVERY_POSTGRES_SERVICE", "postgres")
+	t.Setenv("DISCOVERY_RABBIT_SERVICE", "rabbit")
+	t.Setenv("DISCOVERY_REDIS_SERVICE", "redis")
+	t.Setenv("POSTGRES_USER", "postgres")
+	t.Setenv("POSTGRES_PASS", "postgres")
+	t.Setenv("POSTGRES_DB_NAME", "limiter")
+	t.Setenv("RABBIT_USER", "guest")
+	t.Setenv("RABBIT_PASS", "guest")
+	t.Setenv("CONSUL_STAND_NAME", "local")
+
+	cfg := new(config.Config)
+	require.NoError(t, LoadConfigFromEnv(cfg, WithEnvPath(t.TempDir()), WithValidation(false)))
+	cfg.PostgresAddrs = consul.GetServiceAddressResponse{{Address: "localhost", Port: 5432}}
+	cfg.RabbitAddrs = consul.GetServiceAddressResponse{{Address: "localhost", Port: 5672}}
+	cfg.RedisAddrs = consul.GetServiceAddressResponse{{Address: "localhost", Port: 6379}}
+	require.NoError(t, cfg.Validate())
+
+	var current atomic.Pointer[config.Config]
+	current.Store(cfg)
+
+	s, m, c := newTestService(t, 1)
+	s.mainConfig = &current
+
+	envs, err := s.getDataFromConsulAndVault()
+	require.NoError(t, err)
+	s.envs = envs
+
+	changed := make(chan struct{}, 1)
+	changedEnvs := make(chan []string, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.reload(ctx, changed, changedEnvs)
+
+	t.Run("bad value keeps the last good config", func(t *testing.T) {
+		m.set("REDIS_DB_INDEX", "one", 2)
+		_, err := s.apply()
+		require.ErrorContains(t, err, "REDIS_DB_INDEX")
+		assert.Same(t, cfg, current.Load())
+	})
+
+	t.Run("fixed value is applied", func(t *testing.T) {
+		m.set("REDIS_DB_INDEX", "2", 3)
+		notify(changed)
+
+		select {
+		case names := <-changedEnvs:
+			assert.Equal(t, []string{"REDIS_DB_INDEX"}, names)
+		case <-time.After(time.Second):
+			require.Fail(t, "config is not reloaded")
+		}
+
+		assert.Equal(t, 2, current.Load().Redis.DbIndex)
+		assert.Equal(t, 0, cfg.Redis.DbIndex, "the previous config is not changed")
+	})
+
+	t.Run("consul error is retried with backoff", func(t *testing.T) {
+		m.setErr(errors.New("connection refused"))
+		m.set("REDIS_DB_INDEX", "3", 4)
+		notify(changed)
+
+		require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+		m.setErr(nil)
+		c.Advance(watchMinBackoff)
+
+		select {
+		case names := <-changedEnvs:
+			assert.Equal(t, []string{"REDIS_DB_INDEX"}, names)
+		case <-time.After(time.Second):
+			require.Fail(t, "config is not reloaded")
+		}
+		assert.Equal(t, 3, current.Load().Redis.DbIndex)
+	})
+}
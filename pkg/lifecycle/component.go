@@ -0,0 +1,112 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Component is a part of the service which is started and stopped by the Manager
+type Component interface {
+	// Start starts the component. Long running work must be done in background until Stop is called
+	Start(ctx context.Context) error
+	// Stop stops the component, ctx is done when the stop timeout is exceeded
+	Stop(ctx context.Context) error
+}
+
+// Hooks return component with start and stop funcs, nil func is skipped
+func Hooks(start, stop func(ctx context.Context) error) Component {
+	return hooks{start: start, stop: stop}
+}
+
+type hooks struct {
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+func (h hooks) Start(ctx context.Context) error {
+	if h.start == nil {
+		return nil
+	}
+
+	return h.start(ctx)
+}
+
+func (h hooks) Stop(ctx context.Context) error {
+	if h.stop == nil {
+		return nil
+	}
+
+	return h.stop(ctx)
+}
+
+// Run return component which runs fn in background until the component is stopped, e.g. a server or a worker loop.
+// fn must return when ctx is done. An error returned before stop is reported to Manager.Errors
+func Run(fn func(ctx context.Context) error) Component {
+	return &runner{fn: fn}
+}
+
+type runner struct {
+	fn func(ctx context.Context) error
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *runner) Start(startCtx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done != nil {
+		return errors.New("already started")
+	}
+
+	// the start context limits only the start, the runner lives until stop
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.cancel, r.done = cancel, done
+
+	report := reporterFrom(startCtx)
+
+	go func() {
+		defer close(done)
+
+		if err := r.fn(ctx); err != nil && ctx.Err() == nil {
+			report(err)
+		}
+	}()
+
+	return nil
+}
+
+func (r *runner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type reporterKey struct{}
+
+// reporterFrom return func which reports background errors of the component started with ctx
+func reporterFrom(ctx context.Context) func(err error) {
+	if report, ok := ctx.Value(reporterKey{}).(func(err error)); ok {
+		return report
+	}
+
+	return func(error) {}
+}
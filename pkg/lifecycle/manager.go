@@ -0,0 +1,360 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+// ComponentError is an error of the component
+type ComponentError struct {
+	Name string
+	Err  error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("component %s: %v", e.Name, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+type component struct {
+	name    string
+	c       Component
+	deps    []string
+	envs    []string
+	running bool
+}
+
+// subscribed return true if the component is restarted on change of the env.
+// Env pattern ending with * matches the prefix, e.g. POSTGRES_*
+func (c *component) subscribed(env string) bool {
+	for _, pattern := range c.envs {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(env, prefix) {
+				return true
+			}
+			continue
+		}
+
+		if pattern == env {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ComponentOption func(c *component)
+
+// DependsOn - components which are started before and stopped after the component.
+// The component is restarted when one of them is restarted
+func DependsOn(names ...string) ComponentOption {
+	return func(c *component) {
+		c.deps = append(c.deps, names...)
+	}
+}
+
+// Envs - config env names the component is restarted on, e.g. "HTTP_ADDR" or "POSTGRES_*"
+func Envs(names ...string) ComponentOption {
+	return func(c *component) {
+		c.envs = append(c.envs, names...)
+	}
+}
+
+type Option func(m *Manager)
+
+// WithStopTimeout - time to stop each component. Default 10 seconds
+func WithStopTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.stopTimeout = d
+	}
+}
+
+// Manager starts components in order of their dependencies, stops them in reverse order
+// and restarts only components affected by config changes.
+type Manager struct {
+	logger      log.Logger
+	stopTimeout time.Duration
+	errs        chan error
+
+	mu         sync.Mutex
+	components map[string]*component
+	// names in registration order
+	names []string
+	// order - components sorted by dependencies, built on Start
+	order []*component
+}
+
+func New(logger log.Logger, opts ...Option) *Manager {
+	m := &Manager{
+		logger:      logger,
+		stopTimeout: 10 * time.Second,
+		errs:        make(chan error, 1),
+		components:  make(map[string]*component),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Register adds the component. Components must be registered before Start
+func (m *Manager) Register(name string, c Component, opts ...ComponentOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.components[name]; ok {
+		return fmt.Errorf("component %s is already registered", name)
+	}
+
+	if m.order != nil {
+		return fmt.Errorf("component %s is registered after start", name)
+	}
+
+	comp := &component{name: name, c: c}
+	for _, opt := range opts {
+		opt(comp)
+	}
+
+	m.components[name] = comp
+	m.names = append(m.names, name)
+
+	return nil
+}
+
+// Errors return errors of components which failed in background
+func (m *Manager) Errors() <-chan error {
+	return m.errs
+}
+
+// Start starts all components in order of dependencies. If a component fails to start,
+// already started components are stopped
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.sort()
+	if err != nil {
+		return err
+	}
+	m.order = order
+
+	if err := m.start(ctx, order); err != nil {
+		m.stop(order)
+		return err
+	}
+
+	return nil
+}
+
+// Stop stops all running components in reverse order. Each component is stopped within the stop timeout
+func (m *Manager) Stop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stop(m.order)
+}
+
+// Restart restarts components subscribed to the changed envs and components which depend on them.
+// Return names of restarted components
+func (m *Manager) Restart(ctx context.Context, changedEnvs []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	affected := m.affected(changedEnvs)
+	if len(affected) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(affected))
+	for _, c := range affected {
+		names = append(names, c.name)
+	}
+
+	m.logger.Infof("restarting components: %s", strings.Join(names, ", "))
+
+	if err := m.stop(affected); err != nil {
+		m.logger.Errorf("failed to stop components gracefully: %v", err)
+	}
+
+	return names, m.start(ctx, affected)
+}
+
+// Resume starts components which are not running, e.g. after a failed restart. Running components are kept.
+// Return names of started components
+func (m *Manager) Resume(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stopped []*component
+	for _, c := range m.order {
+		if !c.running {
+			stopped = append(stopped, c)
+		}
+	}
+
+	err := m.start(ctx, stopped)
+
+	var names []string
+	for _, c := range stopped {
+		if c.running {
+			names = append(names, c.name)
+		}
+	}
+
+	return names, err
+}
+
+// Affected return names of components which are restarted on change of the envs
+func (m *Manager) Affected(changedEnvs []string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for _, c := range m.affected(changedEnvs) {
+		names = append(names, c.name)
+	}
+
+	return names
+}
+
+// affected return components subscribed to the envs and their dependents in start order, must be called under lock
+func (m *Manager) affected(changedEnvs []string) []*component {
+	marked := make(map[string]bool)
+
+	// dependencies are before dependents in order, so one pass marks all dependents
+	var res []*component
+	for _, c := range m.order {
+		affected := false
+		for _, env := range changedEnvs {
+			if c.subscribed(env) {
+				affected = true
+				break
+			}
+		}
+
+		for _, dep := range c.deps {
+			if marked[dep] {
+				affected = true
+				break
+			}
+		}
+
+		if affected {
+			marked[c.name] = true
+			res = append(res, c)
+		}
+	}
+
+	return res
+}
+
+func (m *Manager) start(ctx context.Context, order []*component) error {
+	for _, c := range order {
+		if c.running {
+			continue
+		}
+
+		if err := c.c.Start(context.WithValue(ctx, reporterKey{}, m.reporter(c.name))); err != nil {
+			return &ComponentError{Name: c.name, Err: err}
+		}
+
+		c.running = true
+		m.logger.Infof("component %s started", c.name)
+	}
+
+	return nil
+}
+
+// reporter return func which sends background error of the component to Errors
+func (m *Manager) reporter(name string) func(err error) {
+	return func(err error) {
+		select {
+		case m.errs <- &ComponentError{Name: name, Err: err}:
+		default:
+			m.logger.Errorf("component %s failed: %v", name, err)
+		}
+	}
+}
+
+func (m *Manager) stop(order []*component) error {
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		c := order[i]
+		if !c.running {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.stopTimeout)
+		err := c.c.Stop(ctx)
+		cancel()
+
+		c.running = false
+
+		if err != nil {
+			errs = append(errs, &ComponentError{Name: c.name, Err: err})
+			continue
+		}
+
+		m.logger.Infof("component %s stopped", c.name)
+	}
+
+	return errors.Join(errs...)
+}
+
+// sort return components sorted by dependencies, must be called under lock
+func (m *Manager) sort() ([]*component, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(m.components))
+	order := make([]*component, 0, len(m.components))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		c, ok := m.components[name]
+		if !ok {
+			return fmt.Errorf("component %s depends on unknown component %s", path[len(path)-1], name)
+		}
+
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+
+		state[name] = visiting
+		for _, dep := range c.deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		order = append(order, c)
+
+		return nil
+	}
+
+	// independent components keep registration order
+	for _, name := range m.names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,142 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Harardin/rate-limit/pkg/lifecycle"
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	var calls []string
+	component := func(name string) lifecycle.Component {
+		return lifecycle.Hooks(
+			func(context.Context) error {
+				calls = append(calls, "start "+name)
+				return nil
+			},
+			func(context.Context) error {
+				calls = append(calls, "stop "+name)
+				return nil
+			},
+		)
+	}
+
+	m := lifecycle.New(log.New())
+	require.NoError(t, m.Register("http", component("http"), lifecycle.DependsOn("postgres", "redis"), lifecycle.Envs("HTTP_*")))
+	require.NoError(t, m.Register("usage", component("usage"), lifecycle.DependsOn("postgres")))
+	require.NoError(t, m.Register("postgres", component("postgres"), lifecycle.Envs("POSTGRES_*")))
+	require.NoError(t, m.Register("redis", component("redis"), lifecycle.Envs("REDIS_ADDR")))
+	assert.Error(t, m.Register("redis", component("redis")), "duplicate")
+
+	require.NoError(t, m.Start(context.Background()))
+	assert.Equal(t, []string{"start postgres", "start redis", "start http", "start usage"}, calls)
+
+	t.Run("restart subscribed components and dependents", func(t *testing.T) {
+		calls = nil
+
+		names, err := m.Restart(context.Background(), []string{"POSTGRES_PASS"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"postgres", "http", "usage"}, names)
+		assert.Equal(t, []string{
+			"stop usage", "stop http", "stop postgres",
+			"start postgres", "start http", "start usage",
+		}, calls)
+
+		assert.Equal(t, []string{"http"}, m.Affected([]string{"HTTP_ADDR"}))
+		assert.Empty(t, m.Affected([]string{"REDIS_PASS"}))
+	})
+
+	t.Run("stop in reverse order", func(t *testing.T) {
+		calls = nil
+
+		require.NoError(t, m.Stop())
+		assert.Equal(t, []string{"stop usage", "stop http", "stop redis", "stop postgres"}, calls)
+	})
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	var stopped bool
+	m := lifecycle.New(log.New())
+	require.NoError(t, m.Register("postgres", lifecycle.Hooks(nil, func(context.Context) error {
+		stopped = true
+		return nil
+	})))
+	require.NoError(t, m.Register("http", lifecycle.Hooks(func(context.Context) error {
+		return errors.New("address in use")
+	}, nil), lifecycle.DependsOn("postgres")))
+
+	err := m.Start(context.Background())
+	assert.EqualError(t, err, "component http: address in use")
+	assert.True(t, stopped, "started components are stopped")
+
+	t.Run("resume after failed restart", func(t *testing.T) {
+		var calls []string
+		fail := false
+
+		m := lifecycle.New(log.New())
+		require.NoError(t, m.Register("postgres", lifecycle.Hooks(func(context.Context) error {
+			calls = append(calls, "start postgres")
+			return nil
+		}, nil)))
+		require.NoError(t, m.Register("metrics", lifecycle.Hooks(func(context.Context) error {
+			calls = append(calls, "start metrics")
+			if fail {
+				return errors.New("address in use")
+			}
+			return nil
+		}, nil), lifecycle.Envs("PROMETHEUS_*")))
+
+		require.NoError(t, m.Start(context.Background()))
+
+		fail = true
+		_, err := m.Restart(context.Background(), []string{"PROMETHEUS_PORT"})
+		require.EqualError(t, err, "component metrics: address in use")
+
+		_, err = m.Resume(context.Background())
+		require.Error(t, err)
+
+		fail = false
+		calls = nil
+
+		names, err := m.Resume(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"metrics"}, names)
+		assert.Equal(t, []string{"start metrics"}, calls, "running components are kept")
+	})
+
+	t.Run("dependency cycle", func(t *testing.T) {
+		m := lifecycle.New(log.New())
+		require.NoError(t, m.Register("a", lifecycle.Hooks(nil, nil), lifecycle.DependsOn("b")))
+		require.NoError(t, m.Register("b", lifecycle.Hooks(nil, nil), lifecycle.DependsOn("a")))
+
+		assert.EqualError(t, m.Start(context.Background()), "dependency cycle: a -> b -> a")
+	})
+}
+
+func TestRun(t *testing.T) {
+	m := lifecycle.New(log.New())
+
+	stopped := make(chan struct{})
+	require.NoError(t, m.Register("worker", lifecycle.Run(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})))
+	require.NoError(t, m.Register("server", lifecycle.Run(func(ctx context.Context) error {
+		return errors.New("listen failed")
+	})))
+
+	require.NoError(t, m.Start(context.Background()))
+
+	err := <-m.Errors()
+	assert.EqualError(t, err, "component server: listen failed")
+
+	require.NoError(t, m.Stop())
+	<-stopped
+}
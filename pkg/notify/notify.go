@@ -18,14 +18,24 @@ type Service struct {
 }
 
 // NewNotifyService creates new notification service
-func NewNotifyService(notifyURL, emailURL, notifyToken string, l log.Logger) *Service {
-	return &Service{
+//
+// To respect notification provider quotas pass a rate limited client:
+//
+//	notify.NewNotifyService(url, emailURL, token, l, notify.WithTransport(ratelimit.NewTransport(nil, ratelimit.WithRate(5, 10))))
+func NewNotifyService(notifyURL, emailURL, notifyToken string, l log.Logger, opts ...Option) *Service {
+	s := &Service{
 		emailURL: emailURL,
 		url:      notifyURL,
 		token:    notifyToken,
 		cli:      http.DefaultClient,
 		l:        l,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 type notifyMessage struct {
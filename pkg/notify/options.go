@@ -0,0 +1,20 @@
+package notify
+
+import "net/http"
+
+type Option func(*Service)
+
+// WithHTTPClient sets http client used for requests to the notification service
+func WithHTTPClient(cli *http.Client) Option {
+	return func(s *Service) {
+		s.cli = cli
+	}
+}
+
+// WithTransport sets round tripper used for requests to the notification service,
+// e.g. ratelimit.Transport to respect provider quotas
+func WithTransport(rt http.RoundTripper) Option {
+	return func(s *Service) {
+		s.cli = &http.Client{Transport: rt}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Harardin/rate-limit/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -84,3 +85,31 @@ func NewPostgreSQL(ctx context.Context, logger log.Logger, cfg Config, addr stri
 func (p *PostgreSQL) PingDB() error {
 	return p.Ping(context.Background())
 }
+
+// Listen calls fn with notification payload on every notification in the channel
+// until ctx is done or connection is lost.
+//
+// The connection is taken out of the pool for the lifetime of the listener and closed on return,
+// so a LISTENing connection is never reused by other queries.
+func (p *PostgreSQL) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	pooled, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		fn(n.Payload)
+	}
+}
@@ -2,9 +2,12 @@ package prometheus
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"strings"
+	"sync"
 
 	"github.com/Harardin/rate-limit/pkg/log"
 
@@ -29,9 +32,15 @@ type Server struct {
 	logger log.Logger
 	config Config
 
+	// mu guards config and srv, srv is nil until Start
+	mu  sync.Mutex
 	srv *http.Server
 
-	requestCounter *prometheus.CounterVec
+	registry *prometheus.Registry
+
+	requestCounter  *prometheus.CounterVec
+	decisionCounter *prometheus.CounterVec
+	concurrency     prometheus.Gauge
 }
 
 func NewServer(logger log.Logger, config Config, serviceName string) *Server {
@@ -39,53 +48,114 @@ func NewServer(logger log.Logger, config Config, serviceName string) *Server {
 		logger.Errorf("prometheus error: service name is empty")
 	}
 
+	namespace := strings.ReplaceAll(serviceName, "-", "_")
+	registry := prometheus.NewRegistry()
+
 	return &Server{
-		logger: logger,
-		config: config,
+		logger:   logger,
+		config:   config,
+		registry: registry,
 		// TODO: make it configurable, like hc
-		requestCounter: promauto.With(prometheus.NewRegistry()).NewCounterVec(
+		requestCounter: promauto.With(registry).NewCounterVec(
 			prometheus.CounterOpts{
-				Namespace: strings.ReplaceAll(serviceName, "-", "_"),
+				Namespace: namespace,
 				Name:      "requests_counter",
 				Help:      "",
 			}, []string{"query", "status"}),
+		decisionCounter: promauto.With(registry).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "limiter_decisions_total",
+				Help:      "Rate limiter rule evaluations by mode and result",
+			}, []string{"rule", "mode", "result"}),
+		concurrency: promauto.With(registry).NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "concurrency_limit",
+				Help:      "Current adaptive concurrency limit",
+			}),
 	}
 }
 
-// Start prometheus server
-func (s *Server) Start(ctx context.Context) {
-	go func() {
-		if s.config.Disabled {
-			return
-		}
+// SetConfig replaces the config, it is applied on the next Start
+func (s *Server) SetConfig(config Config) {
+	s.mu.Lock()
+	s.config = config
+	s.mu.Unlock()
+}
 
-		port := s.config.Port
-		if port == "" {
-			port = "10001"
-		}
+// Start prometheus server. The port is bound before return, so a busy port is returned as error
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	config := s.config
+	s.mu.Unlock()
 
-		endpoint := s.config.Endpoint
-		if endpoint == "" {
-			endpoint = "/metrics"
-		}
+	if config.Disabled {
+		return nil
+	}
+
+	port := config.Port
+	if port == "" {
+		port = "10001"
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "/metrics"
+	}
 
-		r := mux.NewRouter()
-		r.Path(endpoint).Handler(promhttp.Handler())
+	r := mux.NewRouter()
+	r.Path(endpoint).Handler(promhttp.HandlerFor(
+		prometheus.Gatherers{prometheus.DefaultGatherer, s.registry},
+		promhttp.HandlerOpts{},
+	))
 
-		s.srv = &http.Server{Addr: ":" + port, Handler: r}
+	srv := &http.Server{Addr: ":" + port, Handler: r}
 
-		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			s.logger.Fatalf("failed to start prometheus on port %s: %v", port, err)
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start prometheus on port %s: %v", port, err)
+	}
+
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Errorf("prometheus server on port %s is stopped: %v", port, err)
 		}
 	}()
+
+	return nil
 }
 
 func (s *Server) IncrementRequestsCount(query, result string) {
 	s.requestCounter.WithLabelValues(query, result).Inc()
 }
 
+// IncrementLimiterDecision count rule evaluation. Result is "allowed" or "rejected"
+func (s *Server) IncrementLimiterDecision(rule, mode, result string) {
+	s.decisionCounter.WithLabelValues(rule, mode, result).Inc()
+}
+
+// SetConcurrencyLimit set current adaptive concurrency limit
+func (s *Server) SetConcurrencyLimit(limit int) {
+	s.concurrency.Set(float64(limit))
+}
+
+// Stop prometheus server. Safe to call if the server was not started or is disabled
 func (s *Server) Stop(ctx context.Context) {
-	if err := s.srv.Shutdown(ctx); err != nil {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
 		s.logger.Errorf("failed to stop prometheus http server: %v", err)
 	}
 }
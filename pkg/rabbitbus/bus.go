@@ -2,6 +2,7 @@ package rabbitbus
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -91,6 +92,18 @@ func (s *Service) NewRabbitMQConnection(c Config, addr string) error {
 	return nil
 }
 
+// Ping return error if the connection is closed
+func (s *Service) Ping() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.conn == nil || s.conn.IsClosed() {
+		return errors.New("rabbitmq connection is closed")
+	}
+
+	return nil
+}
+
 func (s *Service) CloseRabbitMQConnection() error {
 	s.logger.Info("closing rabbitmq connection")
 	if s.conn == nil {
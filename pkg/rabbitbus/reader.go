@@ -2,6 +2,7 @@ package rabbitbus
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/Harardin/rate-limit/pkg/log"
 
@@ -28,6 +29,38 @@ func (s *Service) NewReader(ctx context.Context, queueName, consumerName string)
 		return nil, err
 	}
 
+	return s.startReader(ctx, ch, queueName, consumerName), nil
+}
+
+// NewFanoutReader reads every message published to the fanout exchange. The exchange is declared if it doesn't exist,
+// messages are delivered to an exclusive queue of the reader, which is deleted when the reader stops
+func (s *Service) NewFanoutReader(ctx context.Context, exchangeName, consumerName string) (*Reader, error) {
+	ch, err := s.conn.Channel()
+	if err != nil {
+		s.logger.Error("failed to open rabbitmq channel", err)
+		return nil, err
+	}
+
+	if err := ch.ExchangeDeclare(exchangeName, mq.ExchangeFanout, true, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to declare exchange \"%s\": %v", exchangeName, err)
+	}
+
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to declare queue of exchange \"%s\": %v", exchangeName, err)
+	}
+
+	if err := ch.QueueBind(q.Name, "", exchangeName, false, nil); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to bind queue to exchange \"%s\": %v", exchangeName, err)
+	}
+
+	return s.startReader(ctx, ch, q.Name, consumerName), nil
+}
+
+func (s *Service) startReader(ctx context.Context, ch *mq.Channel, queueName, consumerName string) *Reader {
 	r := &Reader{
 		queue:    queueName,
 		consumer: consumerName,
@@ -40,7 +73,7 @@ func (s *Service) NewReader(ctx context.Context, queueName, consumerName string)
 	// starting rabbitmq reader
 	go r.read(ctx, queueName, consumerName)
 
-	return r, nil
+	return r
 }
 
 type msg struct {
@@ -49,6 +82,7 @@ type msg struct {
 
 func (r *Reader) read(ctx context.Context, q, c string) {
 	defer r.ch.Close()
+	defer close(r.m)
 
 	d, err := r.ch.Consume(q, c, false, false, false, false, nil)
 	if err != nil {
@@ -58,8 +92,17 @@ func (r *Reader) read(ctx context.Context, q, c string) {
 
 	for {
 		select {
-		case m := <-d:
-			r.m <- msg{m: &m}
+		case m, ok := <-d:
+			if !ok {
+				r.logger.Info("stop reading from channel due to closed delivery channel")
+				return
+			}
+
+			select {
+			case r.m <- msg{m: &m}:
+			case <-ctx.Done():
+				return
+			}
 		case <-r.stop:
 			r.logger.Info("stop reading from channel do to manual stop")
 			return
@@ -70,7 +113,7 @@ func (r *Reader) read(ctx context.Context, q, c string) {
 	}
 }
 
-// Read msg
+// Read msg. The channel is closed when reading stops
 func (r *Reader) ReceiveMsg() <-chan msg {
 	return r.m
 }
@@ -94,3 +137,8 @@ func (m *msg) Ack() error {
 func (m *msg) Nack() error {
 	return m.m.Nack(false, true)
 }
+
+// Reject declines msg from rabbit without requeue, e.g. malformed message
+func (m *msg) Reject() error {
+	return m.m.Reject(false)
+}
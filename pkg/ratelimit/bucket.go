@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+)
+
+// Bucket is an in-process token bucket.
+//
+// Tokens are refilled with `rate` tokens per second up to `burst` tokens.
+// Bucket is safe for concurrent use.
+type Bucket struct {
+	mu    sync.Mutex
+	clock clock.Clock
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// all calls are paused until this moment (e.g. upstream Retry-After)
+	pausedUntil time.Time
+
+	// rate set by SetRateUntil is replaced with baseRate at rateUntil
+	baseRate  float64
+	rateUntil time.Time
+}
+
+// NewBucket return new token bucket which is full at the start
+//
+// If rate <= 0 the bucket limits calls only while it is paused
+func NewBucket(rate float64, burst int, opts ...BucketOption) *Bucket {
+	options := BucketOptions{Clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Bucket{
+		clock:  options.Clock,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   options.Clock.Now(),
+	}
+}
+
+// Allow takes one token if it is available right now
+func (b *Bucket) Allow() bool {
+	return b.Reserve(0) == 0
+}
+
+// Reserve takes one token and return how long the caller has to wait before using it.
+//
+// If the wait is longer than maxWait, token is not taken and -1 is returned.
+// maxWait == 0 means the call must not wait at all.
+func (b *Bucket) Reserve(maxWait time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	b.refill(now)
+
+	var wait time.Duration
+	if now.Before(b.pausedUntil) {
+		wait = b.pausedUntil.Sub(now)
+		// tokens are refilled during the pause, the deficit is counted from its end
+		b.refill(b.pausedUntil)
+	}
+
+	if b.rate <= 0 {
+		if wait > maxWait {
+			return -1
+		}
+		return wait
+	}
+
+	if b.tokens < 1 {
+		wait += time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+
+	if wait > 0 && wait > maxWait {
+		return -1
+	}
+
+	b.tokens--
+
+	return wait
+}
+
+// Wait blocks until a token is available or ctx is done
+func (b *Bucket) Wait(ctx context.Context) error {
+	maxWait := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = b.clock.Until(deadline)
+	}
+
+	wait := b.Reserve(maxWait)
+	if wait < 0 {
+		return ErrRateLimited
+	}
+
+	if wait == 0 {
+		return nil
+	}
+
+	select {
+	case <-b.clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		b.release()
+		return ctx.Err()
+	}
+}
+
+// release gives back a reserved token, which was not used
+func (b *Bucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.tokens+1, b.burst)
+}
+
+// SetRate changes refill rate, tokens already in the bucket are kept
+func (b *Bucket) SetRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.clock.Now())
+	b.rate = rate
+	b.rateUntil = time.Time{}
+}
+
+// SetRateUntil changes refill rate until the moment, then the rate before the first SetRateUntil call is restored
+func (b *Bucket) SetRateUntil(rate float64, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.clock.Now())
+	if b.rateUntil.IsZero() {
+		b.baseRate = b.rate
+	}
+	b.rate = rate
+	b.rateUntil = until
+}
+
+// Rate return current refill rate
+func (b *Bucket) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(b.clock.Now())
+
+	return b.rate
+}
+
+// PauseUntil forbids taking tokens until t
+func (b *Bucket) PauseUntil(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.After(b.pausedUntil) {
+		b.pausedUntil = t
+	}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if !b.rateUntil.IsZero() && !now.Before(b.rateUntil) {
+		// tokens until rateUntil are refilled with the temporary rate
+		b.fill(b.rateUntil)
+		b.rate = b.baseRate
+		b.rateUntil = time.Time{}
+	}
+
+	b.fill(now)
+}
+
+func (b *Bucket) fill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = math.Min(b.tokens+elapsed*b.rate, b.burst)
+	b.last = now
+}
@@ -0,0 +1,46 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketPause(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("unlimited bucket is paused", func(t *testing.T) {
+		c := clock.NewFake(now)
+		b := ratelimit.NewBucket(0, 1, ratelimit.WithBucketClock(c))
+
+		b.PauseUntil(now.Add(10 * time.Second))
+		assert.False(t, b.Allow())
+		assert.Equal(t, 10*time.Second, b.Reserve(time.Minute))
+
+		c.Advance(10 * time.Second)
+		assert.True(t, b.Allow())
+	})
+
+	t.Run("tokens are refilled during the pause", func(t *testing.T) {
+		c := clock.NewFake(now)
+		b := ratelimit.NewBucket(1, 1, ratelimit.WithBucketClock(c))
+		assert.True(t, b.Allow())
+
+		b.PauseUntil(now.Add(5 * time.Second))
+		assert.Equal(t, 5*time.Second, b.Reserve(time.Minute))
+		assert.Equal(t, 6*time.Second, b.Reserve(time.Minute))
+	})
+
+	t.Run("deficit longer than the pause", func(t *testing.T) {
+		c := clock.NewFake(now)
+		b := ratelimit.NewBucket(0.1, 1, ratelimit.WithBucketClock(c))
+		assert.True(t, b.Allow())
+
+		b.PauseUntil(now.Add(time.Second))
+		assert.Equal(t, 10*time.Second, b.Reserve(time.Minute))
+	})
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+/* Bucket options */
+
+type BucketOption func(*BucketOptions)
+
+type BucketOptions struct {
+	// Clock - default clock.Real
+	Clock clock.Clock
+}
+
+func WithBucketClock(v clock.Clock) BucketOption {
+	return func(o *BucketOptions) {
+		o.Clock = v
+	}
+}
+
+/* Transport options */
+
+type TransportOption func(*TransportOptions)
+
+type TransportOptions struct {
+	// Requests per second. Default 10
+	Rate float64
+	// Default 10
+	Burst int
+	// Block waits for a token instead of failing with ErrRateLimited. Default true
+	Block bool
+	// MaxWait limits the time to wait for a token in block mode. Default - until request context is done
+	MaxWait time.Duration
+	Logger  log.Logger
+	// Clock of the bucket and upstream quota headers. Default clock.Real
+	Clock clock.Clock
+}
+
+func WithRate(rate float64, burst int) TransportOption {
+	return func(o *TransportOptions) {
+		o.Rate = rate
+		o.Burst = burst
+	}
+}
+
+func WithBlock(v bool) TransportOption {
+	return func(o *TransportOptions) {
+		o.Block = v
+	}
+}
+
+func WithMaxWait(v time.Duration) TransportOption {
+	return func(o *TransportOptions) {
+		o.MaxWait = v
+	}
+}
+
+func WithLogger(v log.Logger) TransportOption {
+	return func(o *TransportOptions) {
+		o.Logger = v
+	}
+}
+
+func WithClock(v clock.Clock) TransportOption {
+	return func(o *TransportOptions) {
+		o.Clock = v
+	}
+}
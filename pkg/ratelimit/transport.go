@@ -0,0 +1,223 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/log"
+)
+
+var ErrRateLimited = errors.New("outbound request rate limited")
+
+// Transport is a http.RoundTripper which limits outbound requests with a token bucket.
+//
+// Transport adapts its rate to the upstream quota:
+//   - `Retry-After` on 429/503 responses pauses all requests until the given moment
+//   - `RateLimit-Remaining`/`RateLimit-Reset` (and `X-RateLimit-*`) spread the remaining quota until reset,
+//     then the configured rate is restored
+//
+// Example:
+//
+//	cli := &http.Client{Transport: ratelimit.NewTransport(nil, ratelimit.WithRate(5, 10))}
+type Transport struct {
+	base   http.RoundTripper
+	clock  clock.Clock
+	bucket *Bucket
+
+	rate    float64
+	block   bool
+	maxWait time.Duration
+
+	logger log.Logger
+}
+
+// NewTransport wraps base round tripper. If base is nil http.DefaultTransport is used.
+func NewTransport(base http.RoundTripper, opts ...TransportOption) *Transport {
+	options := TransportOptions{
+		Rate:  10,
+		Burst: 10,
+		Block: true,
+		Clock: clock.Real{},
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		base:    base,
+		clock:   options.Clock,
+		bucket:  NewBucket(options.Rate, options.Burst, WithBucketClock(options.Clock)),
+		rate:    options.Rate,
+		block:   options.Block,
+		maxWait: options.MaxWait,
+		logger:  options.Logger,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.take(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.adapt(resp)
+
+	return resp, nil
+}
+
+// Rate return current adapted rate of the transport
+func (t *Transport) Rate() float64 {
+	return t.bucket.Rate()
+}
+
+func (t *Transport) take(req *http.Request) error {
+	if !t.block {
+		if !t.bucket.Allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	ctx := req.Context()
+	if t.maxWait > 0 {
+		wait := t.bucket.Reserve(t.maxWait)
+		if wait < 0 {
+			return ErrRateLimited
+		}
+
+		if wait == 0 {
+			return nil
+		}
+
+		select {
+		case <-t.clock.After(wait):
+			return nil
+		case <-ctx.Done():
+			t.bucket.release()
+			return ctx.Err()
+		}
+	}
+
+	return t.bucket.Wait(ctx)
+}
+
+func (t *Transport) adapt(resp *http.Response) {
+	now := t.clock.Now()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			t.bucket.PauseUntil(now.Add(d))
+			t.debugf("upstream %s asked to retry after %s", resp.Request.URL.Host, d)
+		}
+	}
+
+	remaining, ok := parseIntHeader(resp.Header, "RateLimit-Remaining", "X-RateLimit-Remaining")
+	if !ok {
+		return
+	}
+
+	reset, ok := parseResetHeader(resp.Header, now)
+	if !ok || reset <= 0 {
+		return
+	}
+
+	if remaining <= 0 {
+		t.bucket.PauseUntil(now.Add(reset))
+		t.debugf("upstream %s quota exhausted, pause for %s", resp.Request.URL.Host, reset)
+		return
+	}
+
+	// spread the remaining quota until reset, but never faster than configured.
+	// The configured rate is restored after reset, if upstream stops sending the headers
+	rate := math.Min(float64(remaining)/reset.Seconds(), t.rate)
+	if t.rate <= 0 {
+		rate = float64(remaining) / reset.Seconds()
+	}
+
+	t.bucket.SetRateUntil(rate, now.Add(reset))
+}
+
+func (t *Transport) debugf(format string, args ...any) {
+	if t.logger != nil {
+		t.logger.Debugf(format, args...)
+	}
+}
+
+// parseRetryAfter parse `Retry-After` header value, which is delay in seconds or http date
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if !t.After(now) {
+		return 0, true
+	}
+
+	return t.Sub(now), true
+}
+
+// parseResetHeader return time until quota reset.
+//
+// `RateLimit-Reset` contains delay in seconds, `X-RateLimit-Reset` is delay or unix timestamp depending on provider.
+func parseResetHeader(h http.Header, now time.Time) (time.Duration, bool) {
+	v, ok := parseIntHeader(h, "RateLimit-Reset", "X-RateLimit-Reset")
+	if !ok || v < 0 {
+		return 0, false
+	}
+
+	// values bigger than a year of seconds are unix timestamps
+	if v > 365*24*60*60 {
+		return time.Unix(v, 0).Sub(now), true
+	}
+
+	return time.Duration(v) * time.Second, true
+}
+
+func parseIntHeader(h http.Header, names ...string) (int64, bool) {
+	for _, name := range names {
+		v := h.Get(name)
+		if v == "" {
+			continue
+		}
+
+		// some providers send a list of values for different windows, use the first one
+		if i := strings.IndexAny(v, ",;"); i != -1 {
+			v = v[:i]
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		return n, true
+	}
+
+	return 0, false
+}
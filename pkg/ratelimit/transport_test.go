@@ -0,0 +1,98 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harardin/rate-limit/pkg/clock"
+	"github.com/Harardin/rate-limit/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	t.Run("fail when limit exceeded", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+
+		cli := &http.Client{Transport: ratelimit.NewTransport(nil, ratelimit.WithRate(1, 2), ratelimit.WithBlock(false))}
+
+		for i := 0; i < 2; i++ {
+			resp, err := cli.Get(srv.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+
+		_, err := cli.Get(srv.URL)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ratelimit.ErrRateLimited))
+	})
+
+	t.Run("pause on retry after", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		cli := &http.Client{Transport: ratelimit.NewTransport(nil, ratelimit.WithRate(100, 100), ratelimit.WithMaxWait(time.Second))}
+
+		resp, err := cli.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		_, err = cli.Get(srv.URL)
+		assert.True(t, errors.Is(err, ratelimit.ErrRateLimited))
+	})
+
+	t.Run("return token of cancelled request", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+
+		cli := &http.Client{Transport: ratelimit.NewTransport(nil, ratelimit.WithRate(10, 1), ratelimit.WithMaxWait(150*time.Millisecond))}
+
+		resp, err := cli.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+
+		_, err = cli.Do(req)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the next token is in 100ms, it would be in 200ms if the cancelled request kept its token
+		resp, err = cli.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+
+	t.Run("adapt rate to remaining quota", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("RateLimit-Remaining", "10")
+			w.Header().Set("RateLimit-Reset", "5")
+		}))
+		defer srv.Close()
+
+		c := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+		tr := ratelimit.NewTransport(nil, ratelimit.WithRate(100, 100), ratelimit.WithClock(c))
+		cli := &http.Client{Transport: tr}
+
+		resp, err := cli.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, float64(2), tr.Rate())
+
+		c.Advance(5 * time.Second)
+		assert.Equal(t, float64(100), tr.Rate(), "configured rate is restored after reset")
+	})
+}
@@ -1,6 +1,13 @@
 package redisclient
 
-import validation "github.com/go-ozzo/ozzo-validation/v4"
+import (
+	"context"
+
+	"github.com/Harardin/rate-limit/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/redis/go-redis/v9"
+)
 
 type Config struct {
 	Addr         string `json:"REDIS_ADDR"`
@@ -16,3 +23,31 @@ func (c *Config) Validate() error {
 		validation.Field(&c.PingInterval, validation.Required),
 	)
 }
+
+type Redis struct {
+	*redis.Client
+}
+
+func NewRedis(ctx context.Context, logger log.Logger, cfg Config, addr string) (*Redis, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Username: cfg.User,
+		Password: cfg.Pass,
+		DB:       cfg.DbIndex,
+	})
+
+	r := &Redis{client}
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	logger.Info("connected to redis")
+
+	return r, nil
+}
+
+func (r *Redis) PingDB() error {
+	return r.Ping(context.Background()).Err()
+}
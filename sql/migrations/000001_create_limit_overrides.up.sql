@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS limit_overrides (
+    id BIGSERIAL PRIMARY KEY,
+    key TEXT NOT NULL,
+    rule TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    "limit" BIGINT NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (key, rule)
+);
+
+CREATE INDEX IF NOT EXISTS limit_overrides_expires_at_idx ON limit_overrides (expires_at);
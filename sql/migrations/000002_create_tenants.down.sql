@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS tenants;
+DROP TABLE IF EXISTS plans;
+DROP FUNCTION IF EXISTS notify_tenants_changed();
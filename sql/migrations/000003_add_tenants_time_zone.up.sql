@@ -0,0 +1,2 @@
+-- IANA time zone of calendar quotas of the tenant
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS usage_buckets (
+    bucket TIMESTAMPTZ NOT NULL,
+    tenant TEXT NOT NULL DEFAULT '',
+    key TEXT NOT NULL,
+    route TEXT NOT NULL,
+    allowed BIGINT NOT NULL DEFAULT 0,
+    rejected BIGINT NOT NULL DEFAULT 0,
+    -- cost units of allowed requests
+    cost BIGINT NOT NULL DEFAULT 0,
+    rejected_cost BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, tenant, key, route)
+);
+
+CREATE INDEX IF NOT EXISTS usage_buckets_tenant_bucket_idx ON usage_buckets (tenant, bucket);
@@ -0,0 +1,3 @@
+-- Load shedding priority of requests of the plan tenants
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal'
+    CHECK (priority IN ('low', 'normal', 'high'));
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS limiter_counters;
@@ -0,0 +1,9 @@
+-- Limiter counters of RATE_LIMIT_STORE=postgres, expired counters are deleted by the store janitor
+CREATE TABLE IF NOT EXISTS limiter_counters (
+    key TEXT PRIMARY KEY,
+    value BIGINT NOT NULL DEFAULT 0,
+    -- NULL for counters without expiration
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS limiter_counters_expires_at_idx ON limiter_counters (expires_at);
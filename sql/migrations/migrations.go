@@ -0,0 +1,9 @@
+// Package migrations embeds sql migrations of the service
+package migrations
+
+import "embed"
+
+// FS contains migrations named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS